@@ -0,0 +1,165 @@
+package canvas
+
+import (
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+// Canvas is a drawing backend that sketches draw through, so the same drawing calls can produce a raster image,
+// a vector file, or both. The method set mirrors gg, which means a *gg.Context is the raster implementation
+type Canvas interface {
+	Width() int
+	Height() int
+
+	// SetRGBA255 sets the color for the following fills and strokes, from 0 to 255
+	SetRGBA255(r, g, b, a int)
+	// SetColor sets the color for the following fills and strokes
+	SetColor(c color.Color)
+	// SetLineWidth sets the width of the following strokes; it is not affected by the transform
+	SetLineWidth(width float64)
+
+	NewSubPath()
+	MoveTo(x, y float64)
+	LineTo(x, y float64)
+	QuadraticTo(x1, y1, x2, y2 float64)
+	CubicTo(x1, y1, x2, y2, x3, y3 float64)
+	ClosePath()
+	DrawRectangle(x, y, w, h float64)
+
+	// Push saves the transform, color, and line width; Pop restores them but keeps the current path
+	Push()
+	Pop()
+	RotateAbout(angle, x, y float64)
+	ScaleAbout(sx, sy, x, y float64)
+
+	Fill()
+	FillPreserve()
+	Stroke()
+	StrokePreserve()
+}
+
+var _ Canvas = (*gg.Context)(nil)
+
+// Tee returns a canvas that repeats every call on each of the canvases; the size is taken from the first
+func Tee(canvases ...Canvas) Canvas {
+	return tee(canvases)
+}
+
+type tee []Canvas
+
+func (t tee) Width() int {
+	return t[0].Width()
+}
+
+func (t tee) Height() int {
+	return t[0].Height()
+}
+
+func (t tee) SetRGBA255(r, g, b, a int) {
+	for _, c := range t {
+		c.SetRGBA255(r, g, b, a)
+	}
+}
+
+func (t tee) SetColor(col color.Color) {
+	for _, c := range t {
+		c.SetColor(col)
+	}
+}
+
+func (t tee) SetLineWidth(width float64) {
+	for _, c := range t {
+		c.SetLineWidth(width)
+	}
+}
+
+func (t tee) NewSubPath() {
+	for _, c := range t {
+		c.NewSubPath()
+	}
+}
+
+func (t tee) MoveTo(x, y float64) {
+	for _, c := range t {
+		c.MoveTo(x, y)
+	}
+}
+
+func (t tee) LineTo(x, y float64) {
+	for _, c := range t {
+		c.LineTo(x, y)
+	}
+}
+
+func (t tee) QuadraticTo(x1, y1, x2, y2 float64) {
+	for _, c := range t {
+		c.QuadraticTo(x1, y1, x2, y2)
+	}
+}
+
+func (t tee) CubicTo(x1, y1, x2, y2, x3, y3 float64) {
+	for _, c := range t {
+		c.CubicTo(x1, y1, x2, y2, x3, y3)
+	}
+}
+
+func (t tee) ClosePath() {
+	for _, c := range t {
+		c.ClosePath()
+	}
+}
+
+func (t tee) DrawRectangle(x, y, w, h float64) {
+	for _, c := range t {
+		c.DrawRectangle(x, y, w, h)
+	}
+}
+
+func (t tee) Push() {
+	for _, c := range t {
+		c.Push()
+	}
+}
+
+func (t tee) Pop() {
+	for _, c := range t {
+		c.Pop()
+	}
+}
+
+func (t tee) RotateAbout(angle, x, y float64) {
+	for _, c := range t {
+		c.RotateAbout(angle, x, y)
+	}
+}
+
+func (t tee) ScaleAbout(sx, sy, x, y float64) {
+	for _, c := range t {
+		c.ScaleAbout(sx, sy, x, y)
+	}
+}
+
+func (t tee) Fill() {
+	for _, c := range t {
+		c.Fill()
+	}
+}
+
+func (t tee) FillPreserve() {
+	for _, c := range t {
+		c.FillPreserve()
+	}
+}
+
+func (t tee) Stroke() {
+	for _, c := range t {
+		c.Stroke()
+	}
+}
+
+func (t tee) StrokePreserve() {
+	for _, c := range t {
+		c.StrokePreserve()
+	}
+}
@@ -0,0 +1,309 @@
+package canvas
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// SVG is a vector canvas that records every fill and stroke as an SVG element. Points are transformed before
+// they are written, so the file matches the raster canvas without relying on SVG transforms
+type SVG struct {
+	width, height int
+	elements      bytes.Buffer
+
+	state svgState
+	stack []svgState
+
+	path       strings.Builder
+	hasCurrent bool
+
+	// mask hides parts of everything drawn after it was set, which starts at maskStart in the elements
+	mask      []byte
+	maskStart int
+}
+
+// svgState is the part of the canvas saved by Push
+type svgState struct {
+	matrix    gg.Matrix
+	color     color.NRGBA
+	lineWidth float64
+}
+
+// NewSVG creates an empty vector canvas; like gg, it starts with black and a line width of 1
+func NewSVG(width, height int) *SVG {
+	return &SVG{
+		width:  width,
+		height: height,
+		state: svgState{
+			matrix:    gg.Identity(),
+			color:     color.NRGBA{A: 255},
+			lineWidth: 1,
+		},
+	}
+}
+
+func (s *SVG) Width() int {
+	return s.width
+}
+
+func (s *SVG) Height() int {
+	return s.height
+}
+
+func (s *SVG) SetRGBA255(r, g, b, a int) {
+	s.state.color = color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(a)}
+}
+
+func (s *SVG) SetColor(c color.Color) {
+	s.state.color = color.NRGBAModel.Convert(c).(color.NRGBA)
+}
+
+func (s *SVG) SetLineWidth(width float64) {
+	s.state.lineWidth = width
+}
+
+func (s *SVG) NewSubPath() {
+	s.hasCurrent = false
+}
+
+func (s *SVG) MoveTo(x, y float64) {
+	x, y = s.state.matrix.TransformPoint(x, y)
+	s.path.WriteString("M" + number(x) + " " + number(y))
+	s.hasCurrent = true
+}
+
+func (s *SVG) LineTo(x, y float64) {
+	if !s.hasCurrent {
+		s.MoveTo(x, y)
+		return
+	}
+	x, y = s.state.matrix.TransformPoint(x, y)
+	s.path.WriteString("L" + number(x) + " " + number(y))
+}
+
+func (s *SVG) QuadraticTo(x1, y1, x2, y2 float64) {
+	if !s.hasCurrent {
+		s.MoveTo(x1, y1)
+	}
+	x1, y1 = s.state.matrix.TransformPoint(x1, y1)
+	x2, y2 = s.state.matrix.TransformPoint(x2, y2)
+	s.path.WriteString("Q" + number(x1) + " " + number(y1) + " " + number(x2) + " " + number(y2))
+}
+
+func (s *SVG) CubicTo(x1, y1, x2, y2, x3, y3 float64) {
+	if !s.hasCurrent {
+		s.MoveTo(x1, y1)
+	}
+	x1, y1 = s.state.matrix.TransformPoint(x1, y1)
+	x2, y2 = s.state.matrix.TransformPoint(x2, y2)
+	x3, y3 = s.state.matrix.TransformPoint(x3, y3)
+	s.path.WriteString("C" + number(x1) + " " + number(y1) + " " + number(x2) + " " + number(y2) + " " + number(x3) + " " + number(y3))
+}
+
+func (s *SVG) ClosePath() {
+	if s.hasCurrent {
+		s.path.WriteString("Z")
+	}
+}
+
+func (s *SVG) DrawRectangle(x, y, w, h float64) {
+	s.NewSubPath()
+	s.MoveTo(x, y)
+	s.LineTo(x+w, y)
+	s.LineTo(x+w, y+h)
+	s.LineTo(x, y+h)
+	s.ClosePath()
+}
+
+func (s *SVG) Push() {
+	s.stack = append(s.stack, s.state)
+}
+
+func (s *SVG) Pop() {
+	if len(s.stack) == 0 {
+		return
+	}
+	s.state = s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+func (s *SVG) RotateAbout(angle, x, y float64) {
+	s.state.matrix = s.state.matrix.Translate(x, y).Rotate(angle).Translate(-x, -y)
+}
+
+func (s *SVG) ScaleAbout(sx, sy, x, y float64) {
+	s.state.matrix = s.state.matrix.Translate(x, y).Scale(sx, sy).Translate(-x, -y)
+}
+
+func (s *SVG) Fill() {
+	s.FillPreserve()
+	s.clearPath()
+}
+
+// FillPreserve writes the path as a filled element; invisible paths are left out to keep the file small
+func (s *SVG) FillPreserve() {
+	if s.path.Len() == 0 || s.state.color.A == 0 {
+		return
+	}
+	fmt.Fprintf(&s.elements, "<path d=\"%s\" fill=\"%s\"%s/>\n", s.path.String(), hex(s.state.color), opacity("fill-opacity", s.state.color))
+}
+
+func (s *SVG) Stroke() {
+	s.StrokePreserve()
+	s.clearPath()
+}
+
+// StrokePreserve writes the path as a stroked element; invisible paths are left out to keep the file small
+func (s *SVG) StrokePreserve() {
+	if s.path.Len() == 0 || s.state.color.A == 0 {
+		return
+	}
+	fmt.Fprintf(&s.elements, "<path d=\"%s\" fill=\"none\" stroke=\"%s\"%s stroke-width=\"%s\" stroke-linecap=\"round\" stroke-linejoin=\"round\"/>\n",
+		s.path.String(), hex(s.state.color), opacity("stroke-opacity", s.state.color), number(s.state.lineWidth))
+}
+
+// DrawImage places an image over the whole canvas, which is how raster backgrounds are carried into the file
+func (s *SVG) DrawImage(img image.Image) error {
+	encoded := &bytes.Buffer{}
+	if err := png.Encode(encoded, img); err != nil {
+		return fmt.Errorf("could not encode the image: %w", err)
+	}
+	fmt.Fprintf(&s.elements, "<image width=\"%d\" height=\"%d\" preserveAspectRatio=\"none\" href=\"data:image/png;base64,%s\"/>\n",
+		s.width, s.height, base64.StdEncoding.EncodeToString(encoded.Bytes()))
+	return nil
+}
+
+// SetMask hides everything drawn from now on wherever the mask is transparent, like SetMask on a gg context.
+// It is written as an SVG mask holding the mask as an image, stretched over the canvas
+func (s *SVG) SetMask(mask image.Image) error {
+	bounds := mask.Bounds()
+	luminance := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			_, _, _, a := mask.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			luminance.Pix[luminance.PixOffset(x, y)] = uint8(a >> 8)
+		}
+	}
+	encoded := &bytes.Buffer{}
+	if err := png.Encode(encoded, luminance); err != nil {
+		return fmt.Errorf("could not encode the mask: %w", err)
+	}
+	s.mask = encoded.Bytes()
+	s.maskStart = s.elements.Len()
+	return nil
+}
+
+// WriteTo writes the complete SVG document
+func (s *SVG) WriteTo(w io.Writer) (int64, error) {
+	buffered := bufio.NewWriter(w)
+	written := int64(0)
+	n, err := fmt.Fprintf(buffered, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", s.width, s.height, s.width, s.height)
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+	elements := s.elements.Bytes()
+	if s.mask != nil {
+		// masks are luminance, so the white parts of the image are the parts that show
+		n, err = fmt.Fprintf(buffered, "<mask id=\"mask\" maskUnits=\"userSpaceOnUse\" x=\"0\" y=\"0\" width=\"%d\" height=\"%d\"><image width=\"%d\" height=\"%d\" preserveAspectRatio=\"none\" href=\"data:image/png;base64,%s\"/></mask>\n",
+			s.width, s.height, s.width, s.height, base64.StdEncoding.EncodeToString(s.mask))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		start := min(s.maskStart, len(elements))
+		m, err := buffered.Write(elements[:start])
+		written += int64(m)
+		if err != nil {
+			return written, err
+		}
+		n, err = buffered.WriteString("<g mask=\"url(#mask)\">\n")
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		elements = elements[start:]
+	}
+	m, err := buffered.Write(elements)
+	written += int64(m)
+	if err != nil {
+		return written, err
+	}
+	if s.mask != nil {
+		n, err = buffered.WriteString("</g>\n")
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	n, err = buffered.WriteString("</svg>\n")
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+	return written, buffered.Flush()
+}
+
+// Save writes the document to a file
+func (s *SVG) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create that file: %w", err)
+	}
+	defer f.Close()
+	if _, err := s.WriteTo(f); err != nil {
+		return fmt.Errorf("could not write the svg: %w", err)
+	}
+	return nil
+}
+
+// MarshalBinary returns the elements drawn so far; the transform, color, and any unfinished path are not
+// included, so it should be called between shapes
+func (s *SVG) MarshalBinary() ([]byte, error) {
+	return bytes.Clone(s.elements.Bytes()), nil
+}
+
+// UnmarshalBinary replaces the elements with ones returned by MarshalBinary
+func (s *SVG) UnmarshalBinary(data []byte) error {
+	s.elements.Reset()
+	s.elements.Write(data)
+	return nil
+}
+
+func (s *SVG) clearPath() {
+	s.path.Reset()
+	s.hasCurrent = false
+}
+
+// number formats a coordinate compactly; hundredths of a pixel are more than enough
+func number(v float64) string {
+	formatted := strconv.FormatFloat(v, 'f', 2, 64)
+	formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	if formatted == "-0" || formatted == "" {
+		return "0"
+	}
+	return formatted
+}
+
+func hex(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// opacity returns the attribute for a translucent color, or nothing for an opaque one
+func opacity(attribute string, c color.NRGBA) string {
+	if c.A == 255 {
+		return ""
+	}
+	return fmt.Sprintf(" %s=\"%s\"", attribute, strconv.FormatFloat(float64(c.A)/255, 'g', 4, 64))
+}
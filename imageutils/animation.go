@@ -0,0 +1,292 @@
+package imageutils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"strings"
+)
+
+type AnimationFormat string
+
+const (
+	AnimationFormatGIF  AnimationFormat = "gif"
+	AnimationFormatAPNG AnimationFormat = "apng"
+	AnimationFormatNone AnimationFormat = ""
+)
+
+// GetAnimationFormatFromString is a helper to get the AnimationFormat from a string
+func GetAnimationFormatFromString(input string) (AnimationFormat, error) {
+	switch strings.ToLower(input) {
+	case "", "none":
+		return AnimationFormatNone, nil
+	case "gif":
+		return AnimationFormatGIF, nil
+	case "apng":
+		return AnimationFormatAPNG, nil
+	default:
+		return AnimationFormatNone, errors.New("invalid animation format")
+	}
+}
+
+// Extension returns the file extension used when writing the animation
+func (f AnimationFormat) Extension() string {
+	if f == AnimationFormatAPNG {
+		return "png"
+	}
+	return string(f)
+}
+
+// AnimationOptions configures an AnimationWriter
+type AnimationOptions struct {
+	Format AnimationFormat
+	// Delay is the time each frame is shown, in milliseconds
+	Delay int
+	// Hold is the time the last frame is shown, in milliseconds; if 0, Delay is used
+	Hold int
+	// Loops is the number of times the animation plays; 0 loops forever
+	Loops int
+	// Palette is used for GIF frames; if empty, the web safe palette is used
+	Palette color.Palette
+}
+
+// AnimationWriter writes frames to an animated file as they are added. The last frame added is held back
+// until the next frame or Close so it can be given the hold delay
+type AnimationWriter struct {
+	options *AnimationOptions
+	f       *os.File
+
+	// gif
+	anim *gif.GIF
+
+	// apng
+	width    int
+	height   int
+	frames   uint32
+	sequence uint32
+	actlAt   int64
+	pending  []byte
+}
+
+// NewAnimationWriter creates the target file and prepares it to receive frames
+func NewAnimationWriter(path string, options *AnimationOptions) (*AnimationWriter, error) {
+	if options == nil || options.Format == AnimationFormatNone {
+		return nil, errors.New("an animation format is required")
+	}
+	if options.Loops < 0 {
+		return nil, fmt.Errorf("invalid loops %d; it must be 0 or more", options.Loops)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not create that file: %w", err)
+	}
+	a := &AnimationWriter{
+		options: options,
+		f:       f,
+	}
+	if options.Format == AnimationFormatGIF {
+		loops := -1
+		if options.Loops == 0 {
+			loops = 0
+		} else if options.Loops > 1 {
+			loops = options.Loops - 1
+		}
+		a.anim = &gif.GIF{LoopCount: loops}
+	}
+	return a, nil
+}
+
+// AddFrame appends a snapshot of the image to the animation
+func (a *AnimationWriter) AddFrame(img image.Image) error {
+	switch a.options.Format {
+	case AnimationFormatGIF:
+		colors := a.options.Palette
+		if len(colors) == 0 {
+			colors = palette.WebSafe
+		}
+		frame := image.NewPaletted(img.Bounds(), colors)
+		draw.FloydSteinberg.Draw(frame, img.Bounds(), img, img.Bounds().Min)
+		a.anim.Image = append(a.anim.Image, frame)
+		a.anim.Delay = append(a.anim.Delay, a.options.Delay/10)
+		return nil
+	case AnimationFormatAPNG:
+		return a.addAPNGFrame(img)
+	}
+	return fmt.Errorf("invalid animation format: %v", a.options.Format)
+}
+
+// Close writes any held frame and finalizes the file
+func (a *AnimationWriter) Close() error {
+	defer a.f.Close()
+	hold := a.options.Hold
+	if hold == 0 {
+		hold = a.options.Delay
+	}
+	switch a.options.Format {
+	case AnimationFormatGIF:
+		if len(a.anim.Image) == 0 {
+			return errors.New("no frames were added to the animation")
+		}
+		a.anim.Delay[len(a.anim.Delay)-1] = hold / 10
+		if err := gif.EncodeAll(a.f, a.anim); err != nil {
+			return fmt.Errorf("could not encode that animation: %w", err)
+		}
+		return nil
+	case AnimationFormatAPNG:
+		if a.pending == nil {
+			return errors.New("no frames were added to the animation")
+		}
+		if err := a.flushAPNGFrame(hold); err != nil {
+			return err
+		}
+		if err := writePNGChunk(a.f, "IEND", nil); err != nil {
+			return err
+		}
+		// now that we know how many frames there are, go back and fill in the animation control chunk
+		if _, err := a.f.Seek(a.actlAt, io.SeekStart); err != nil {
+			return fmt.Errorf("could not finalize that animation: %w", err)
+		}
+		return writePNGChunk(a.f, "acTL", a.actl())
+	}
+	return fmt.Errorf("invalid animation format: %v", a.options.Format)
+}
+
+func (a *AnimationWriter) addAPNGFrame(img image.Image) error {
+	bounds := img.Bounds()
+	if a.sequence == 0 && a.pending == nil {
+		a.width, a.height = bounds.Dx(), bounds.Dy()
+		if err := a.writeAPNGHeader(); err != nil {
+			return err
+		}
+	} else if bounds.Dx() != a.width || bounds.Dy() != a.height {
+		return errors.New("all animation frames must be the same size")
+	} else if err := a.flushAPNGFrame(a.options.Delay); err != nil {
+		return err
+	}
+
+	data, err := compressAPNGFrame(img)
+	if err != nil {
+		return err
+	}
+	a.pending = data
+	return nil
+}
+
+func (a *AnimationWriter) writeAPNGHeader() error {
+	if _, err := a.f.Write([]byte("\x89PNG\r\n\x1a\n")); err != nil {
+		return fmt.Errorf("could not write that animation: %w", err)
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(a.width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(a.height))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // truecolor with alpha
+	if err := writePNGChunk(a.f, "IHDR", ihdr); err != nil {
+		return err
+	}
+	pos, err := a.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("could not write that animation: %w", err)
+	}
+	a.actlAt = pos
+	return writePNGChunk(a.f, "acTL", a.actl())
+}
+
+func (a *AnimationWriter) actl() []byte {
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], a.frames)
+	binary.BigEndian.PutUint32(actl[4:], uint32(a.options.Loops))
+	return actl
+}
+
+// flushAPNGFrame writes the pending frame with the provided delay in milliseconds
+func (a *AnimationWriter) flushAPNGFrame(delay int) error {
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], a.sequence)
+	binary.BigEndian.PutUint32(fctl[4:], uint32(a.width))
+	binary.BigEndian.PutUint32(fctl[8:], uint32(a.height))
+	binary.BigEndian.PutUint16(fctl[20:], uint16(min(delay, 65535)))
+	binary.BigEndian.PutUint16(fctl[22:], 1000)
+	if err := writePNGChunk(a.f, "fcTL", fctl); err != nil {
+		return err
+	}
+	a.sequence++
+
+	// the first frame doubles as the default image for viewers that do not support APNG
+	if a.frames == 0 {
+		if err := writePNGChunk(a.f, "IDAT", a.pending); err != nil {
+			return err
+		}
+	} else {
+		fdat := make([]byte, 4+len(a.pending))
+		binary.BigEndian.PutUint32(fdat[0:], a.sequence)
+		copy(fdat[4:], a.pending)
+		if err := writePNGChunk(a.f, "fdAT", fdat); err != nil {
+			return err
+		}
+		a.sequence++
+	}
+	a.frames++
+	a.pending = nil
+	return nil
+}
+
+// compressAPNGFrame converts the image to filtered, compressed 8 bit RGBA scanlines
+func compressAPNGFrame(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	row := make([]byte, 1+4*bounds.Dx())
+	for y := 0; y < bounds.Dy(); y++ {
+		// use the sub filter, which is cheap and compresses photographic content reasonably well
+		line := nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+4*bounds.Dx()]
+		row[0] = 1
+		for i := range line {
+			if i < 4 {
+				row[1+i] = line[i]
+			} else {
+				row[1+i] = line[i] - line[i-4]
+			}
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, fmt.Errorf("could not compress that frame: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("could not compress that frame: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func writePNGChunk(w io.Writer, name string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:], uint32(len(data)))
+	copy(header[4:], name)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+	for _, b := range [][]byte{header, data, footer} {
+		if _, err := w.Write(b); err != nil {
+			return fmt.Errorf("could not write that animation: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package imageutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+
+	// webp is only ever decoded, so it is registered here rather than next to the encoders
+	_ "golang.org/x/image/webp"
+)
+
+// exifOrientationTag is the EXIF tag that says how the camera was held
+const exifOrientationTag = 0x0112
+
+// DetectFormat sniffs the contents of a file, whatever it is named, and returns the format it decodes as,
+// such as png, jpeg, gif, bmp, tiff, or webp
+func DetectFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("could not open the image: %w", err)
+	}
+	defer f.Close()
+	_, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", fmt.Errorf("could not decode image: %w", err)
+	}
+	return format, nil
+}
+
+// DecodeImage decodes an image in any of the supported formats and turns it upright according to its EXIF
+// orientation, so photos from phones are not sideways
+func DecodeImage(data []byte) (image.Image, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image: %w", err)
+	}
+	return orient(img, exifOrientation(data, format)), nil
+}
+
+// exifOrientation finds the EXIF orientation of an encoded image, which is 1 for upright when it has none
+func exifOrientation(data []byte, format string) int {
+	var exif []byte
+	switch format {
+	case "jpeg":
+		exif = jpegExif(data)
+	case "png":
+		exif = pngExif(data)
+	case "webp":
+		exif = webpExif(data)
+	case "tiff":
+		// a tiff is laid out the same way as EXIF, so the orientation is in its first directory
+		exif = data
+	}
+	if exif == nil {
+		return 1
+	}
+	return tiffOrientation(exif)
+}
+
+// jpegExif returns the EXIF of a jpeg, which is an APP1 segment before the image data
+func jpegExif(data []byte) []byte {
+	for i := len(jpegSOI); i+4 <= len(data) && data[i] == 0xff; {
+		marker, length := data[i+1], int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xda || marker == 0xd9 || length < 2 || i+2+length > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// pngExif returns the contents of the eXIf chunk of a png
+func pngExif(data []byte) []byte {
+	for i := len(pngSignature); i+8 <= len(data); {
+		length, kind := int(binary.BigEndian.Uint32(data[i:])), string(data[i+4:i+8])
+		if kind == "IDAT" || length < 0 || i+12+length > len(data) {
+			return nil
+		}
+		if kind == "eXIf" {
+			return data[i+8 : i+8+length]
+		}
+		i += 12 + length
+	}
+	return nil
+}
+
+// webpExif returns the contents of the EXIF chunk of a webp, which some tools start with the same header as
+// in a jpeg
+func webpExif(data []byte) []byte {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil
+	}
+	for i := 12; i+8 <= len(data); {
+		kind, length := string(data[i:i+4]), int(binary.LittleEndian.Uint32(data[i+4:]))
+		if length < 0 || i+8+length > len(data) {
+			return nil
+		}
+		if kind == "EXIF" {
+			return bytes.TrimPrefix(data[i+8:i+8+length], []byte("Exif\x00\x00"))
+		}
+		// chunks are padded to an even length
+		i += 8 + length + length%2
+	}
+	return nil
+}
+
+// tiffOrientation reads the orientation tag from the first directory of a tiff structure
+func tiffOrientation(data []byte) int {
+	if len(data) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return 1
+	}
+	offset := int64(order.Uint32(data[4:]))
+	if offset+2 > int64(len(data)) {
+		return 1
+	}
+	count := int64(order.Uint16(data[offset:]))
+	for i := int64(0); i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > int64(len(data)) {
+			return 1
+		}
+		if order.Uint16(data[entry:]) != exifOrientationTag {
+			continue
+		}
+		// the orientation is a single short, which sits at the start of the value
+		if orientation := int(order.Uint16(data[entry+8:])); orientation >= 1 && orientation <= 8 {
+			return orientation
+		}
+		return 1
+	}
+	return 1
+}
+
+// orient turns an image upright for one of the eight EXIF orientations. 2 to 4 mirror or turn it halfway
+// around, and 5 to 8 lie on their side, so the width and height swap
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	w, h := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := w, h
+	if orientation >= 5 {
+		dstWidth, dstHeight = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			sx, sy := x, y
+			switch orientation {
+			case 2:
+				sx = w - 1 - x
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sy = h - 1 - y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
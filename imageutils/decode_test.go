@@ -0,0 +1,121 @@
+package imageutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// letters builds an image with one distinct value per pixel, given as rows of letters
+func letters(rows ...string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x := range row {
+			img.Set(x, y, color.RGBA{row[x], 0, 0, 255})
+		}
+	}
+	return img
+}
+
+// rows reads an image built by letters back into its rows
+func rows(img image.Image) []string {
+	bounds := img.Bounds()
+	out := []string{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := []byte{}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			row = append(row, byte(r>>8))
+		}
+		out = append(out, string(row))
+	}
+	return out
+}
+
+func TestOrient(t *testing.T) {
+	src := letters("abc", "def")
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{0, []string{"abc", "def"}},
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+		{9, []string{"abc", "def"}},
+	}
+	for _, tt := range tests {
+		got := rows(orient(src, tt.orientation))
+		if len(got) != len(tt.want) {
+			t.Errorf("orient(%d) = %v, want %v", tt.orientation, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("orient(%d) = %v, want %v", tt.orientation, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// exifWithOrientation builds the tiff structure of an EXIF block holding only an orientation
+func exifWithOrientation(order binary.ByteOrder, orientation uint16) []byte {
+	data := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(data, "II")
+	} else {
+		copy(data, "MM")
+	}
+	order.PutUint16(data[2:], 42)
+	order.PutUint32(data[4:], 8)
+	order.PutUint16(data[8:], 1)
+	order.PutUint16(data[10:], exifOrientationTag)
+	order.PutUint16(data[12:], 3)
+	order.PutUint32(data[14:], 1)
+	order.PutUint16(data[18:], orientation)
+	return data
+}
+
+func TestExifOrientation(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for orientation := uint16(1); orientation <= 8; orientation++ {
+			if got := tiffOrientation(exifWithOrientation(order, orientation)); got != int(orientation) {
+				t.Errorf("tiffOrientation(%v, %d) = %d", order, orientation, got)
+			}
+		}
+	}
+	for _, data := range [][]byte{nil, []byte("II"), []byte("XX*\x00\x08\x00\x00\x00"), exifWithOrientation(binary.BigEndian, 12)} {
+		if got := tiffOrientation(data); got != 1 {
+			t.Errorf("tiffOrientation(%q) = %d, want 1", data, got)
+		}
+	}
+}
+
+func TestDecodeImageRotatesJPEG(t *testing.T) {
+	encoded := &bytes.Buffer{}
+	if err := jpeg.Encode(encoded, image.NewRGBA(image.Rect(0, 0, 40, 20)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// an APP1 segment right after the start of the image holds the EXIF
+	exif := append([]byte("Exif\x00\x00"), exifWithOrientation(binary.BigEndian, 6)...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	data := append(append(append([]byte{}, jpegSOI...), append(segment, exif...)...), encoded.Bytes()[len(jpegSOI):]...)
+
+	img, err := DecodeImage(data)
+	if err != nil {
+		t.Fatalf("DecodeImage() error = %v", err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(20, 40) {
+		t.Errorf("DecodeImage() is %v, want it turned upright to 20x40", got)
+	}
+}
@@ -0,0 +1,98 @@
+package imageutils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// the compression levels for png and tiff; tiff is either uncompressed or deflated, so every level other
+// than none deflates it
+const (
+	CompressionNone    = "none"
+	CompressionFast    = "fast"
+	CompressionDefault = "default"
+	CompressionBest    = "best"
+)
+
+var pngCompression = map[string]png.CompressionLevel{
+	"":                 png.DefaultCompression,
+	CompressionNone:    png.NoCompression,
+	CompressionFast:    png.BestSpeed,
+	CompressionDefault: png.DefaultCompression,
+	CompressionBest:    png.BestCompression,
+}
+
+// EncodeOptions tune the encoders; the zero value uses the defaults of each format
+type EncodeOptions struct {
+	// Quality is the jpg quality from 1 to 100
+	Quality int
+	// Compression is none, fast, default, or best for png and tiff
+	Compression string
+	// Colors saves a png as paletted with at most this many colors, from 2 to 256, and limits the colors of a gif
+	Colors int
+}
+
+// ParseEncodeOptions reads options written as key=value pairs separated by commas, such as
+// quality=90,compression=best
+func ParseEncodeOptions(input string) (*EncodeOptions, error) {
+	options := &EncodeOptions{}
+	for _, pair := range strings.Split(input, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid output option %s; it must be written as key=value", pair)
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "quality":
+			quality, err := strconv.Atoi(value)
+			if err != nil || quality < 1 || quality > 100 {
+				return nil, fmt.Errorf("invalid quality %s; it must be from 1 to 100", value)
+			}
+			options.Quality = quality
+		case "compression":
+			value = strings.ToLower(value)
+			if _, ok := pngCompression[value]; !ok || value == "" {
+				return nil, fmt.Errorf("invalid compression %s; it must be %s, %s, %s, or %s", value, CompressionNone, CompressionFast, CompressionDefault, CompressionBest)
+			}
+			options.Compression = value
+		case "colors":
+			colors, err := strconv.Atoi(value)
+			if err != nil || colors < 2 || colors > 256 {
+				return nil, fmt.Errorf("invalid colors %s; it must be from 2 to 256", value)
+			}
+			options.Colors = colors
+		default:
+			return nil, fmt.Errorf("unknown output option %s; the options are quality, compression, and colors", key)
+		}
+	}
+	return options, nil
+}
+
+// quantize reduces an image to a palette of at most size colors built from the image itself, keeping a fully
+// transparent entry if the image has any transparency
+func quantize(img image.Image, size int) *image.Paletted {
+	bounds := img.Bounds()
+	colors := PaletteFromImage(img, size)
+	if !isOpaque(img) {
+		colors = append(PaletteFromImage(img, size-1), color.Transparent)
+	}
+	paletted := image.NewPaletted(bounds, colors)
+	draw.FloydSteinberg.Draw(paletted, bounds, img, bounds.Min)
+	return paletted
+}
+
+func isOpaque(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
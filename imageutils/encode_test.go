@@ -0,0 +1,47 @@
+package imageutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEncodeOptions(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    *EncodeOptions
+		wantErr string
+	}{
+		{input: "", want: &EncodeOptions{}},
+		{input: "quality=90", want: &EncodeOptions{Quality: 90}},
+		{input: " Quality = 1 , COMPRESSION=Best, colors=256 ", want: &EncodeOptions{Quality: 1, Compression: CompressionBest, Colors: 256}},
+		{input: "compression=none,", want: &EncodeOptions{Compression: CompressionNone}},
+		{input: "colors=2", want: &EncodeOptions{Colors: 2}},
+		{input: "quality", wantErr: "written as key=value"},
+		{input: "quality=0", wantErr: "invalid quality 0"},
+		{input: "quality=101", wantErr: "invalid quality 101"},
+		{input: "quality=high", wantErr: "invalid quality high"},
+		{input: "compression=", wantErr: "invalid compression"},
+		{input: "compression=max", wantErr: "invalid compression max"},
+		{input: "colors=1", wantErr: "invalid colors 1"},
+		{input: "colors=257", wantErr: "invalid colors 257"},
+		{input: "dither=on", wantErr: "unknown output option dither"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseEncodeOptions(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseEncodeOptions() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEncodeOptions() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEncodeOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,19 @@
 package imageutils
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"image"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"os"
 	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
 )
 
 type ImageFormat string
@@ -15,6 +21,10 @@ type ImageFormat string
 const (
 	ImageFormatJPG     ImageFormat = "jpg"
 	ImageFormatPNG     ImageFormat = "png"
+	ImageFormatSVG     ImageFormat = "svg"
+	ImageFormatGIF     ImageFormat = "gif"
+	ImageFormatBMP     ImageFormat = "bmp"
+	ImageFormatTIFF    ImageFormat = "tiff"
 	ImageFormatInvalid ImageFormat = ""
 )
 
@@ -27,44 +37,95 @@ func GetImageFormatFromString(input string) (ImageFormat, error) {
 		return ImageFormatJPG, nil
 	case "png":
 		return ImageFormatPNG, nil
+	case "svg":
+		return ImageFormatSVG, nil
+	case "gif":
+		return ImageFormatGIF, nil
+	case "bmp":
+		return ImageFormatBMP, nil
+	case "tif", "tiff":
+		return ImageFormatTIFF, nil
 	default:
 		return ImageFormatInvalid, errors.New("invalid format")
 	}
 }
 
-// LoadImage loads an image from the filesystem and attempts to decode it
+// LoadImage loads an image from the filesystem and attempts to decode it, turning it upright if it has an
+// EXIF orientation
 func LoadImage(path string) (image.Image, error) {
-	f, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("could not load image: %w", err)
 	}
-	defer f.Close()
-	img, _, err := image.Decode(f)
-	if err != nil {
-		return nil, fmt.Errorf("could not decode image: %w", err)
-	}
-	return img, nil
+	return DecodeImage(data)
 }
 
-// SaveImage takes an image and saves it to the target path in the desired format
-func SaveImage(img image.Image, format ImageFormat, path string) error {
+// SaveImage takes an image and saves it to the target path in the desired format, along with any metadata.
+// options may be nil to use the defaults of the encoder
+func SaveImage(img image.Image, format ImageFormat, path string, metadata Metadata, options *EncodeOptions) error {
+	if format == ImageFormatSVG {
+		return errors.New("svg output is vector and must be written from a vector canvas rather than an image")
+	}
 	f, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("could not create that file: %w", err)
 	}
 	defer f.Close()
+	return EncodeImage(f, img, format, metadata, options)
+}
 
+// EncodeImage writes the image to w in a raster format. Metadata is stored as text chunks in a png and as
+// comments in a jpg, and is left out of the other formats
+func EncodeImage(w io.Writer, img image.Image, format ImageFormat, metadata Metadata, options *EncodeOptions) error {
+	if options == nil {
+		options = &EncodeOptions{}
+	}
+	target := w
+	encoded := &bytes.Buffer{}
+	if len(metadata) > 0 && (format == ImageFormatPNG || format == ImageFormatJPG) {
+		target = encoded
+	}
+	var err error
 	switch format {
 	case ImageFormatJPG:
-		err = jpeg.Encode(f, img, nil)
+		var jpegOptions *jpeg.Options
+		if options.Quality > 0 {
+			jpegOptions = &jpeg.Options{Quality: options.Quality}
+		}
+		err = jpeg.Encode(target, img, jpegOptions)
 	case ImageFormatPNG:
-		err = png.Encode(f, img)
+		encoder := &png.Encoder{CompressionLevel: pngCompression[options.Compression]}
+		if options.Colors > 0 {
+			img = quantize(img, options.Colors)
+		}
+		err = encoder.Encode(target, img)
+	case ImageFormatGIF:
+		colors := options.Colors
+		if colors == 0 {
+			colors = 256
+		}
+		err = gif.Encode(target, quantize(img, colors), nil)
+	case ImageFormatBMP:
+		err = bmp.Encode(target, img)
+	case ImageFormatTIFF:
+		tiffOptions := &tiff.Options{}
+		if options.Compression != CompressionNone {
+			tiffOptions.Compression, tiffOptions.Predictor = tiff.Deflate, true
+		}
+		err = tiff.Encode(target, img, tiffOptions)
 	default:
-		return fmt.Errorf("invalid output format passed: %v; only png and jpg are supported at this time", format)
+		return fmt.Errorf("invalid output format passed: %v; only png, jpg, gif, bmp, and tiff are supported at this time", format)
 	}
 
 	if err != nil {
 		return fmt.Errorf("could not encode that image: %w", err)
 	}
-	return nil
+	switch {
+	case target == w:
+		return nil
+	case format == ImageFormatJPG:
+		return writeJPEGMetadata(w, encoded.Bytes(), metadata)
+	default:
+		return writePNGMetadata(w, encoded.Bytes(), metadata)
+	}
 }
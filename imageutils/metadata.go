@@ -0,0 +1,244 @@
+package imageutils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Metadata is text stored inside an image file, such as how it was made
+type Metadata map[string]string
+
+// jpegCommentLimit is the most text a single JPEG comment segment can hold
+const jpegCommentLimit = 65533
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	jpegSOI      = []byte{0xff, 0xd8}
+)
+
+// Keys returns the keys in a stable order
+func (m Metadata) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writePNGMetadata copies an encoded PNG to w with the metadata added as text chunks right after the header.
+// Values that are plain ASCII are written as tEXt and anything else as uncompressed iTXt, which holds UTF-8
+func writePNGMetadata(w io.Writer, encoded []byte, metadata Metadata) error {
+	if !bytes.HasPrefix(encoded, pngSignature) || len(encoded) < len(pngSignature)+8 {
+		return errors.New("could not add metadata: the PNG is malformed")
+	}
+	headerEnd := len(pngSignature) + 12 + int(binary.BigEndian.Uint32(encoded[len(pngSignature):]))
+	if headerEnd > len(encoded) {
+		return errors.New("could not add metadata: the PNG is malformed")
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(encoded)+1024))
+	buf.Write(encoded[:headerEnd])
+	for _, key := range metadata.Keys() {
+		if len(key) == 0 || len(key) > 79 {
+			return fmt.Errorf("could not add metadata: the key %q must be 1 to 79 characters", key)
+		}
+		chunk, data := "tEXt", key+"\x00"+metadata[key]
+		if !isASCII(metadata[key]) {
+			chunk, data = "iTXt", key+"\x00\x00\x00\x00\x00"+metadata[key]
+		}
+		if err := writePNGChunk(buf, chunk, []byte(data)); err != nil {
+			return err
+		}
+	}
+	buf.Write(encoded[headerEnd:])
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeJPEGMetadata copies an encoded JPEG to w with a comment segment for each entry, written as key=value
+func writeJPEGMetadata(w io.Writer, encoded []byte, metadata Metadata) error {
+	if !bytes.HasPrefix(encoded, jpegSOI) {
+		return errors.New("could not add metadata: the JPEG is malformed")
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(encoded)+1024))
+	buf.Write(jpegSOI)
+	for _, key := range metadata.Keys() {
+		comment := key + "=" + metadata[key]
+		if len(comment) > jpegCommentLimit {
+			return fmt.Errorf("could not add metadata: %s is too long for a JPEG comment", key)
+		}
+		buf.Write([]byte{0xff, 0xfe})
+		binary.Write(buf, binary.BigEndian, uint16(len(comment)+2))
+		buf.WriteString(comment)
+	}
+	buf.Write(encoded[len(jpegSOI):])
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadMetadata reads the text stored in a PNG or JPEG file
+func ReadMetadata(path string) (Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the image: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	start, err := r.Peek(len(pngSignature))
+	switch {
+	case bytes.HasPrefix(start, pngSignature):
+		return readPNGMetadata(r)
+	case bytes.HasPrefix(start, jpegSOI):
+		return readJPEGMetadata(r)
+	case err != nil && !errors.Is(err, io.EOF):
+		return nil, fmt.Errorf("could not read the image: %w", err)
+	}
+	return nil, errors.New("metadata can only be read from png and jpg files")
+}
+
+// readPNGMetadata collects the tEXt, zTXt, and iTXt chunks of a PNG
+func readPNGMetadata(r io.Reader) (Metadata, error) {
+	if _, err := io.CopyN(io.Discard, r, int64(len(pngSignature))); err != nil {
+		return nil, err
+	}
+	metadata := Metadata{}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("could not read the PNG: %w", err)
+		}
+		length, kind := binary.BigEndian.Uint32(header), string(header[4:])
+		if kind == "IDAT" || kind == "IEND" {
+			// text after the image data is allowed but rare, and is not worth reading the whole file for
+			return metadata, nil
+		}
+		if kind != "tEXt" && kind != "zTXt" && kind != "iTXt" {
+			if _, err := io.CopyN(io.Discard, r, int64(length)+4); err != nil {
+				return nil, fmt.Errorf("could not read the PNG: %w", err)
+			}
+			continue
+		}
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("could not read the PNG: %w", err)
+		}
+		key, value, err := parsePNGText(kind, data[:length])
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = value
+	}
+}
+
+// parsePNGText splits a text chunk into its keyword and text
+func parsePNGText(kind string, data []byte) (string, string, error) {
+	key, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", "", fmt.Errorf("the PNG has a malformed %s chunk", kind)
+	}
+	switch kind {
+	case "tEXt":
+		return string(key), latin1(rest), nil
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", errors.New("the PNG has a malformed zTXt chunk")
+		}
+		text, err := inflate(rest[1:])
+		return string(key), latin1(text), err
+	}
+	// iTXt has a compression flag and method, then a language tag and translated keyword, both ended by a zero
+	if len(rest) < 2 {
+		return "", "", errors.New("the PNG has a malformed iTXt chunk")
+	}
+	compressed := rest[0] == 1
+	rest = rest[2:]
+	for i := 0; i < 2; i++ {
+		var found bool
+		if _, rest, found = bytes.Cut(rest, []byte{0}); !found {
+			return "", "", errors.New("the PNG has a malformed iTXt chunk")
+		}
+	}
+	if compressed {
+		text, err := inflate(rest)
+		return string(key), string(text), err
+	}
+	return string(key), string(rest), nil
+}
+
+// readJPEGMetadata collects the comment segments of a JPEG, up to the start of the image data
+func readJPEGMetadata(r io.Reader) (Metadata, error) {
+	if _, err := io.CopyN(io.Discard, r, int64(len(jpegSOI))); err != nil {
+		return nil, err
+	}
+	metadata := Metadata{}
+	comments := 0
+	marker := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return nil, fmt.Errorf("could not read the JPEG: %w", err)
+		}
+		if marker[0] != 0xff {
+			return nil, errors.New("the JPEG is malformed")
+		}
+		if marker[1] == 0xda {
+			return metadata, nil
+		}
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, errors.New("the JPEG is malformed")
+		}
+		if marker[1] != 0xfe {
+			if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+				return nil, fmt.Errorf("could not read the JPEG: %w", err)
+			}
+			continue
+		}
+		comment := make([]byte, length)
+		if _, err := io.ReadFull(r, comment); err != nil {
+			return nil, fmt.Errorf("could not read the JPEG: %w", err)
+		}
+		if key, value, ok := strings.Cut(string(comment), "="); ok && !strings.ContainsAny(key, " \n") {
+			metadata[key] = value
+			continue
+		}
+		// comments written by other tools are kept under a numbered key
+		comments++
+		metadata[fmt.Sprintf("comment%d", comments)] = string(comment)
+	}
+}
+
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress PNG text: %w", err)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf || s[i] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// latin1 converts the text of tEXt and zTXt chunks, which is Latin-1 rather than UTF-8
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
@@ -0,0 +1,52 @@
+package imageutils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		img.Set(x, x%8, color.RGBA{uint8(x * 16), 80, 160, 255})
+	}
+	metadata := Metadata{
+		"Software":    "art 1.2.3",
+		"art:command": "art transform --input 'a b.png' --name-template {name}=x",
+		"art:seed":    "42",
+		// anything that is not ASCII goes through iTXt in a png
+		"art:source": "input/café ☕.jpg",
+	}
+	for _, format := range []ImageFormat{ImageFormatPNG, ImageFormatJPG} {
+		t.Run(string(format), func(t *testing.T) {
+			encoded := &bytes.Buffer{}
+			if err := EncodeImage(encoded, img, format, metadata, nil); err != nil {
+				t.Fatalf("EncodeImage() error = %v", err)
+			}
+			decoded, decodedFormat, err := image.Decode(bytes.NewReader(encoded.Bytes()))
+			if err != nil {
+				t.Fatalf("the output no longer decodes: %v", err)
+			}
+			if decoded.Bounds() != img.Bounds() || decodedFormat != map[ImageFormat]string{ImageFormatPNG: "png", ImageFormatJPG: "jpeg"}[format] {
+				t.Errorf("the output decodes as a %s of %v, want a %s of %v", decodedFormat, decoded.Bounds(), format, img.Bounds())
+			}
+
+			path := filepath.Join(t.TempDir(), "out."+string(format))
+			if err := os.WriteFile(path, encoded.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadMetadata(path)
+			if err != nil {
+				t.Fatalf("ReadMetadata() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, metadata) {
+				t.Errorf("ReadMetadata() = %v, want %v", got, metadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package imageutils
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// paletteSampleLimit caps how many pixels are considered when building a palette so large photos stay fast
+const paletteSampleLimit = 250000
+
+// PaletteFromImage builds a palette of at most size colors from an image using median cut
+func PaletteFromImage(img image.Image, size int) color.Palette {
+	if size < 1 {
+		size = 1
+	}
+	bounds := img.Bounds()
+	step := 1
+	for (bounds.Dx()/step)*(bounds.Dy()/step) > paletteSampleLimit {
+		step++
+	}
+
+	pixels := make([][3]uint8, 0, (bounds.Dx()/step+1)*(bounds.Dy()/step+1))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			pixels = append(pixels, [3]uint8{c.R, c.G, c.B})
+		}
+	}
+	if len(pixels) == 0 {
+		return color.Palette{color.Black}
+	}
+
+	boxes := [][][3]uint8{pixels}
+	for len(boxes) < size {
+		// split the box with the widest channel range
+		best, bestChannel, bestRange := -1, 0, 0
+		for i := range boxes {
+			if len(boxes[i]) < 2 {
+				continue
+			}
+			channel, r := widestChannel(boxes[i])
+			if r > bestRange {
+				best, bestChannel, bestRange = i, channel, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		sort.Slice(box, func(a, b int) bool {
+			return box[a][bestChannel] < box[b][bestChannel]
+		})
+		mid := len(box) / 2
+		boxes[best] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for i := range boxes {
+		var r, g, b int
+		for _, p := range boxes[i] {
+			r += int(p[0])
+			g += int(p[1])
+			b += int(p[2])
+		}
+		n := len(boxes[i])
+		palette = append(palette, color.NRGBA{uint8(r / n), uint8(g / n), uint8(b / n), 255})
+	}
+	return palette
+}
+
+// widestChannel returns the channel with the largest spread in the box and that spread
+func widestChannel(box [][3]uint8) (int, int) {
+	min := [3]uint8{255, 255, 255}
+	max := [3]uint8{}
+	for _, p := range box {
+		for c := 0; c < 3; c++ {
+			if p[c] < min[c] {
+				min[c] = p[c]
+			}
+			if p[c] > max[c] {
+				max[c] = p[c]
+			}
+		}
+	}
+	channel, spread := 0, 0
+	for c := 0; c < 3; c++ {
+		if int(max[c])-int(min[c]) > spread {
+			channel, spread = c, int(max[c])-int(min[c])
+		}
+	}
+	return channel, spread
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"github.com/kevineaton/art/transformer"
 	"github.com/spf13/cobra"
@@ -17,11 +18,20 @@ const (
 )
 
 func main() {
-	rand.Seed(time.Now().Unix())
+	// the first interrupt lets the commands stop cleanly; once it has been seen, a second one exits right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
 	root := Root()
-	if err := root.Execute(); err != nil {
-		fmt.Printf("ERROR: Could not establish the CLI: %+v\n", err)
+	if cmd, err := root.ExecuteContextC(ctx); err != nil {
+		// commands that fail report their own errors; anything else went wrong setting up the CLI
+		if !cmd.SilenceErrors {
+			fmt.Printf("ERROR: Could not establish the CLI: %+v\n", err)
+		}
 		os.Exit(1)
 	}
 
@@ -45,33 +55,63 @@ func Root() *cobra.Command {
 	}
 
 	rootCmd.AddCommand(transformer.GetCommand())
+	rootCmd.AddCommand(transformer.GetRenderCommand())
+	rootCmd.AddCommand(transformer.GetInspectCommand())
+	rootCmd.AddCommand(transformer.GetSweepCommand())
+	rootCmd.AddCommand(presetsCommand())
+	rootCmd.AddCommand(configCommand())
+	rootCmd.PersistentFlags().String(presetFlag, "", "A named preset from the settings file to start from; flags that are passed still take priority")
+	rootCmd.PersistentFlags().String(configFlag, "", "The settings file to read instead of settings.yaml, json, or toml in the working directory; also set with ART_CONFIG")
 
 	return rootCmd
 }
 
 func initializeViper(cmd *cobra.Command) error {
+	v, err := loadSettings(configPath(cmd))
+	if err != nil {
+		return err
+	}
+	return bindFlags(cmd, v)
+}
+
+// loadSettings reads the settings file at path, or settings.* in the working directory if path is empty
+func loadSettings(path string) (*viper.Viper, error) {
 	v := viper.New()
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("could not read the settings file %s: %w", path, err)
+		}
+		return v, nil
+	}
 	v.SetConfigName("settings")
 	v.AddConfigPath(".")
 
 	// attempt to read the file
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return err
+			return nil, err
 		}
 	}
-	v.SetEnvPrefix(envPrefix)
-
-	bindFlags(cmd, v)
-	return nil
+	return v, nil
 }
 
-func bindFlags(cmd *cobra.Command, v *viper.Viper) {
+// bindFlags fills in the flags that were not passed on the command line from the settings file, env vars,
+// and the selected preset
+func bindFlags(cmd *cobra.Command, v *viper.Viper) error {
+	preset, _ := presetName(cmd, v)
+	settings, err := resolveSettings(cmd, v, preset)
+	if err != nil {
+		return err
+	}
 	cmd.Flags().VisitAll(func(f *pflag.Flag) {
-
-		if !f.Changed && v.IsSet(f.Name) {
-			val := v.Get(f.Name)
-			cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val))
+		s, ok := settings[f.Name]
+		if f.Changed || !ok || err != nil {
+			return
+		}
+		if err = setFlag(cmd.Flags(), f.Name, s.value); err != nil {
+			err = fmt.Errorf("%w, from %s", err, s.source)
 		}
 	})
+	return err
 }
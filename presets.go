@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	// presetsKey is the section of the settings file that holds the named presets
+	presetsKey = "presets"
+	// presetDescriptionKey is an optional line about a preset, shown by art presets list
+	presetDescriptionKey = "description"
+	// presetFlag selects a preset on any command
+	presetFlag = "preset"
+)
+
+// presetsCommand returns the command that lists and shows the presets in the settings file
+func presetsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "presets",
+		Short: "List and show the named presets in the settings file",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the presets in the settings file",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			v, err := loadSettings(configPath(cmd))
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				return
+			}
+			names := presetNames(v)
+			if len(names) == 0 {
+				fmt.Printf("No presets found; add them under %s in the settings file\n", presetsKey)
+				return
+			}
+			for _, name := range names {
+				if description := v.GetString(presetsKey + "." + name + "." + presetDescriptionKey); description != "" {
+					fmt.Printf("%s: %s\n", name, description)
+					continue
+				}
+				fmt.Printf("%s\n", name)
+			}
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show <name>",
+		Short: "Show the flags a preset sets, and the commands that only some of them apply to",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			v, err := loadSettings(configPath(cmd))
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				return
+			}
+			if err := showPreset(cmd.Root(), v, args[0]); err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+			}
+		},
+	})
+	return cmd
+}
+
+// presetNames lists the presets in the settings file
+func presetNames(v *viper.Viper) []string {
+	names := []string{}
+	for name := range v.GetStringMap(presetsKey) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadPreset returns the entries of a preset
+func loadPreset(v *viper.Viper, name string) (map[string]interface{}, error) {
+	key := presetsKey + "." + strings.ToLower(name)
+	if !v.IsSet(key) {
+		names := presetNames(v)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown preset %s; there are no presets in the settings file", name)
+		}
+		return nil, fmt.Errorf("unknown preset %s; the presets are %s", name, strings.Join(names, ", "))
+	}
+	return v.GetStringMap(key), nil
+}
+
+// presetValues works out the flags a preset sets for a command. Flags at the top of the preset apply to every
+// command that has them, and a section named after a command holds flags for that command alone, which win
+// over the shared ones
+func presetValues(cmd *cobra.Command, v *viper.Viper, name string) (map[string]interface{}, error) {
+	preset, err := loadPreset(v, name)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	var own map[string]interface{}
+	for key, value := range preset {
+		if key == presetDescriptionKey {
+			continue
+		}
+		if section, ok := value.(map[string]interface{}); ok {
+			if _, err := findCommand(cmd.Root(), key); err != nil {
+				return nil, fmt.Errorf("the preset %s has a section for %s: %w", name, key, err)
+			}
+			if key == sectionName(cmd) {
+				own = section
+			}
+			continue
+		}
+		if err := checkPresetFlag(cmd.Root(), name, key); err != nil {
+			return nil, err
+		}
+		// flags that belong to other commands are left for them
+		if cmd.Flags().Lookup(key) != nil {
+			values[key] = value
+		}
+	}
+	for key, value := range own {
+		if cmd.Flags().Lookup(key) == nil || key == presetFlag {
+			return nil, fmt.Errorf("the preset %s sets %s for %s, which is not one of its flags", name, key, cmd.Name())
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// checkPresetFlag makes sure a shared entry of a preset is a flag of at least one command
+func checkPresetFlag(root *cobra.Command, preset, flag string) error {
+	if flag == presetFlag {
+		return fmt.Errorf("the preset %s cannot select another preset", preset)
+	}
+	found := false
+	visitCommands(root, func(c *cobra.Command) {
+		if c.Flags().Lookup(flag) != nil {
+			found = true
+		}
+	})
+	if !found {
+		return fmt.Errorf("the preset %s sets %s, which is not a flag of any command", preset, flag)
+	}
+	return nil
+}
+
+// showPreset prints the flags of a preset, shared ones first and then those of each command section
+func showPreset(root *cobra.Command, v *viper.Viper, name string) error {
+	preset, err := loadPreset(v, name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", strings.ToLower(name))
+	if description, ok := preset[presetDescriptionKey]; ok {
+		fmt.Printf("  %v\n", description)
+	}
+	keys := []string{}
+	sections := []string{}
+	for key, value := range preset {
+		switch {
+		case key == presetDescriptionKey:
+		case isSection(value):
+			sections = append(sections, key)
+		default:
+			if err := checkPresetFlag(root, name, key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	sort.Strings(sections)
+	for _, key := range keys {
+		printPresetFlag("  ", key, preset[key])
+	}
+	for _, section := range sections {
+		command, err := findCommand(root, section)
+		if err != nil {
+			return fmt.Errorf("the preset %s has a section for %s: %w", name, section, err)
+		}
+		fmt.Printf("  for %s:\n", section)
+		flags := preset[section].(map[string]interface{})
+		sectionKeys := []string{}
+		for key := range flags {
+			if command.Flags().Lookup(key) == nil {
+				return fmt.Errorf("the preset %s sets %s for %s, which is not one of its flags", name, key, section)
+			}
+			sectionKeys = append(sectionKeys, key)
+		}
+		sort.Strings(sectionKeys)
+		for _, key := range sectionKeys {
+			printPresetFlag("    ", key, flags[key])
+		}
+	}
+	return nil
+}
+
+// printPresetFlag prints an entry the way it would be passed on the command line; lists repeat the flag
+func printPresetFlag(indent, flag string, value interface{}) {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		fmt.Printf("%s--%s=%v\n", indent, flag, v)
+	}
+}
+
+// setFlag sets a flag from a value in the settings file; a list sets the flag once for each entry, which
+// is how flags that can be repeated collect them
+func setFlag(flags *pflag.FlagSet, name string, value interface{}) error {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		if err := flags.Set(name, fmt.Sprintf("%v", v)); err != nil {
+			return fmt.Errorf("invalid setting for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func isSection(value interface{}) bool {
+	_, ok := value.(map[string]interface{})
+	return ok
+}
+
+// findCommand finds a command by its path below the root, such as presets show, or by a name that only one
+// command anywhere below the root has
+func findCommand(root *cobra.Command, name string) (*cobra.Command, error) {
+	words := strings.Fields(name)
+	if len(words) > 0 && words[0] == root.Name() {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("unknown command %s", name)
+	}
+	if len(words) > 1 {
+		found, rest, err := root.Find(words)
+		if err != nil || found == root || len(rest) > 0 {
+			return nil, fmt.Errorf("unknown command %s", name)
+		}
+		return found, nil
+	}
+	found := []*cobra.Command{}
+	visitCommands(root, func(c *cobra.Command) {
+		if c != root && c.Name() == words[0] {
+			found = append(found, c)
+		}
+	})
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("unknown command %s", name)
+	case 1:
+		return found[0], nil
+	}
+	paths := []string{}
+	for _, c := range found {
+		paths = append(paths, strings.TrimPrefix(c.CommandPath(), root.Name()+" "))
+	}
+	return nil, fmt.Errorf("the command %s is ambiguous; use one of %s", name, strings.Join(paths, ", "))
+}
+
+func visitCommands(c *cobra.Command, fn func(*cobra.Command)) {
+	fn(c)
+	for _, child := range c.Commands() {
+		visitCommands(child, fn)
+	}
+}
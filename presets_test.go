@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindCommand(t *testing.T) {
+	root, _ := testCommands()
+	root.AddCommand(presetsCommand(), configCommand())
+
+	tests := []struct {
+		name     string
+		wantPath string
+		wantErr  string
+	}{
+		{name: "transform", wantPath: "art transform"},
+		{name: "presets", wantPath: "art presets"},
+		{name: "presets show", wantPath: "art presets show"},
+		{name: "art presets show", wantPath: "art presets show"},
+		{name: "config show", wantPath: "art config show"},
+		{name: "list", wantPath: "art presets list"},
+		{name: "show", wantErr: "ambiguous; use one of config show, presets show"},
+		{name: "presets missing", wantErr: "unknown command presets missing"},
+		{name: "missing", wantErr: "unknown command missing"},
+		{name: "", wantErr: "unknown command"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findCommand(root, tt.name)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("findCommand() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findCommand() error = %v", err)
+			}
+			if got.CommandPath() != tt.wantPath {
+				t.Errorf("findCommand() = %s, want %s", got.CommandPath(), tt.wantPath)
+			}
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package progressbar
 
-import "github.com/schollz/progressbar/v3"
+import (
+	"io"
+	"os"
+
+	"github.com/schollz/progressbar/v3"
+)
 
 // this is used to consolidate the configuration options for a progress bar
 
@@ -11,6 +16,8 @@ type BarOptions struct {
 	ShowBytes    bool
 	Width        int
 	Description  string
+	// Writer is where the bar is drawn; it defaults to stdout
+	Writer io.Writer
 }
 
 // GetProgressBar gets a progress bar with the ability to set overrides
@@ -24,11 +31,15 @@ func GetProgressBar(options *BarOptions) *progressbar.ProgressBar {
 	if options.Description == "" {
 		options.Description = "Working..."
 	}
+	if options.Writer == nil {
+		options.Writer = os.Stdout
+	}
 
 	return progressbar.NewOptions(options.Max,
 		progressbar.OptionEnableColorCodes(options.EnableColors),
 		progressbar.OptionShowBytes(options.ShowBytes),
 		progressbar.OptionSetWidth(options.Width),
 		progressbar.OptionSetDescription(options.Description),
+		progressbar.OptionSetWriter(options.Writer),
 	)
 }
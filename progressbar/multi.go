@@ -0,0 +1,95 @@
+package progressbar
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// MultiBar reports the combined progress of several tasks running at the same time on a single bar
+type MultiBar struct {
+	bar    *progressbar.ProgressBar
+	prefix string
+	mu     sync.Mutex
+	active []string
+	done   int
+	tasks  int
+}
+
+// NewMultiBar creates a combined bar; Max in the options should be the sum of the work across all tasks
+// and tasks is the number of tasks that will be started
+func NewMultiBar(options *BarOptions, tasks int) *MultiBar {
+	if options == nil {
+		options = &BarOptions{}
+	}
+	m := &MultiBar{
+		prefix: options.Description,
+		tasks:  tasks,
+	}
+	if m.prefix == "" {
+		m.prefix = "Working on"
+	}
+	options.Description = m.describe()
+	m.bar = GetProgressBar(options)
+	return m
+}
+
+// Start marks a task as in progress
+func (m *MultiBar) Start(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = append(m.active, name)
+	m.bar.Describe(m.describe())
+}
+
+// Add adds completed work to the bar; it is safe to call from multiple goroutines
+func (m *MultiBar) Add(n int) {
+	m.bar.Add(n)
+}
+
+// Finish marks a task as complete
+func (m *MultiBar) Finish(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(name)
+	m.done++
+	m.bar.Describe(m.describe())
+}
+
+// Abandon marks a task as no longer in progress without counting it as complete
+func (m *MultiBar) Abandon(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(name)
+	m.bar.Describe(m.describe())
+}
+
+// Close finishes the bar
+func (m *MultiBar) Close() error {
+	return m.bar.Close()
+}
+
+// Stop leaves the bar showing how far it got, for when the work ends early
+func (m *MultiBar) Stop() error {
+	return m.bar.Exit()
+}
+
+// remove takes a task out of the active list; callers must hold the lock
+func (m *MultiBar) remove(name string) {
+	for i := range m.active {
+		if m.active[i] == name {
+			m.active = append(m.active[:i], m.active[i+1:]...)
+			break
+		}
+	}
+}
+
+// describe builds the description; callers must hold the lock
+func (m *MultiBar) describe() string {
+	if len(m.active) == 0 {
+		return fmt.Sprintf("[%d of %d] %s", m.done, m.tasks, m.prefix)
+	}
+	return fmt.Sprintf("[%d of %d] %s %s", m.done, m.tasks, m.prefix, strings.Join(m.active, ", "))
+}
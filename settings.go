@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configFlag points at a settings file other than the one in the working directory
+const configFlag = "config"
+
+// setting is the value a flag gets from outside the command line and where it came from
+type setting struct {
+	value  interface{}
+	source string
+}
+
+// configCommand returns the command that explains where the value of each flag comes from
+func configCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show the configuration the commands run with",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show [command]",
+		Short: "Show the value of every flag of a command, after the settings file, env vars, and preset are merged, and where each came from; subcommands are named by their path, such as presets show",
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			name := "transform"
+			if len(args) > 0 {
+				name = strings.Join(args, " ")
+			}
+			if err := showConfig(cmd, name); err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+			}
+		},
+	})
+	return cmd
+}
+
+// configPath is the settings file chosen with --config or ART_CONFIG, or empty to look in the working directory
+func configPath(cmd *cobra.Command) string {
+	if path, _ := cmd.Flags().GetString(configFlag); path != "" {
+		return path
+	}
+	return os.Getenv(envName(configFlag))
+}
+
+// envName is the env var for a flag, optionally for a single command, such as ART_TRANSFORM_DEST_WIDTH
+func envName(parts ...string) string {
+	name := envPrefix + "_" + strings.Join(parts, "_")
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// sectionName is the section of the settings file and the part of env var names for a command, which is the
+// command directly under art, so subcommands share the section of their parent
+func sectionName(cmd *cobra.Command) string {
+	for cmd.HasParent() && cmd.Parent().HasParent() {
+		cmd = cmd.Parent()
+	}
+	return cmd.Name()
+}
+
+// presetName is the preset selected with --preset, ART_PRESET, or preset in the settings file
+func presetName(cmd *cobra.Command, v *viper.Viper) (string, string) {
+	if flag := cmd.Flags().Lookup(presetFlag); flag != nil && flag.Changed {
+		return flag.Value.String(), "command line"
+	}
+	if name, ok := os.LookupEnv(envName(presetFlag)); ok && name != "" {
+		return name, envName(presetFlag)
+	}
+	if name := v.GetString(presetFlag); name != "" {
+		return name, settingsSource(v, "")
+	}
+	return "", ""
+}
+
+// resolveSettings works out the value of each flag of a command that comes from outside the command line.
+// Later layers win: the top of the settings file, the section for the command, the preset, ART_<FLAG>, and
+// then ART_<COMMAND>_<FLAG>
+func resolveSettings(cmd *cobra.Command, v *viper.Viper, preset string) (map[string]setting, error) {
+	section := sectionName(cmd)
+	presetFlags := map[string]interface{}{}
+	if preset != "" {
+		values, err := presetValues(cmd, v, preset)
+		if err != nil {
+			return nil, err
+		}
+		presetFlags = values
+	}
+	settings := map[string]setting{}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		switch f.Name {
+		case "help", configFlag, presetFlag:
+			return
+		}
+		if v.IsSet(f.Name) {
+			settings[f.Name] = setting{v.Get(f.Name), settingsSource(v, "")}
+		}
+		// presets has no section of its own, since its key holds the presets themselves
+		if section != presetsKey && v.IsSet(section+"."+f.Name) {
+			settings[f.Name] = setting{v.Get(section + "." + f.Name), settingsSource(v, section)}
+		}
+		if value, ok := presetFlags[f.Name]; ok {
+			settings[f.Name] = setting{value, "preset " + strings.ToLower(preset)}
+		}
+		for _, name := range []string{envName(f.Name), envName(section, f.Name)} {
+			if value, ok := os.LookupEnv(name); ok {
+				settings[f.Name] = setting{value, name}
+			}
+		}
+	})
+	return settings, nil
+}
+
+// settingsSource describes a value from the settings file, along with its section
+func settingsSource(v *viper.Viper, section string) string {
+	source := filepath.Base(v.ConfigFileUsed())
+	if section != "" {
+		source += " (" + section + ")"
+	}
+	return source
+}
+
+// showConfig prints every flag of a command with its value and where the value came from
+func showConfig(cmd *cobra.Command, name string) error {
+	target, err := findCommand(cmd.Root(), name)
+	if err != nil {
+		return err
+	}
+	if !target.Flags().HasFlags() {
+		return fmt.Errorf("the command %s has no flags of its own", name)
+	}
+	v, err := loadSettings(configPath(cmd))
+	if err != nil {
+		return err
+	}
+	preset, presetSource := presetName(cmd, v)
+	settings, err := resolveSettings(target, v, preset)
+	if err != nil {
+		return err
+	}
+	if v.ConfigFileUsed() != "" {
+		fmt.Printf("Settings file: %s\n", v.ConfigFileUsed())
+	} else {
+		fmt.Printf("Settings file: none\n")
+	}
+	if preset != "" {
+		fmt.Printf("Preset: %s, from %s\n", preset, presetSource)
+	}
+	fmt.Printf("\n")
+
+	names := []string{}
+	target.Flags().VisitAll(func(f *pflag.Flag) {
+		switch f.Name {
+		case "help", configFlag, presetFlag:
+			return
+		}
+		names = append(names, f.Name)
+	})
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "FLAG\tVALUE\tSOURCE\n")
+	for _, name := range names {
+		source := "default"
+		if s, ok := settings[name]; ok {
+			// setting the value on the command checks it and shows it the way the command will see it
+			if err := setFlag(target.Flags(), name, s.value); err != nil {
+				return fmt.Errorf("%w, from %s", err, s.source)
+			}
+			source = s.source
+		}
+		fmt.Fprintf(w, "--%s\t%s\t%s\n", name, target.Flags().Lookup(name).Value.String(), source)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// testCommands builds a root with a transform command that has a couple of flags
+func testCommands() (*cobra.Command, *cobra.Command) {
+	root := &cobra.Command{Use: "art"}
+	root.PersistentFlags().String(presetFlag, "", "")
+	root.PersistentFlags().String(configFlag, "", "")
+	transform := &cobra.Command{Use: "transform", Run: func(*cobra.Command, []string) {}}
+	transform.Flags().Int("cycles", 10000, "")
+	transform.Flags().String("shapes", "polygon", "")
+	root.AddCommand(transform)
+	return root, transform
+}
+
+func TestResolveSettingsPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   string
+		env        map[string]string
+		preset     string
+		wantValue  string
+		wantSource string
+	}{
+		{
+			name:       "top of the file",
+			settings:   "cycles: 1\n",
+			wantValue:  "1",
+			wantSource: "settings.yaml",
+		},
+		{
+			name:       "section wins over the top",
+			settings:   "cycles: 1\ntransform:\n  cycles: 2\n",
+			wantValue:  "2",
+			wantSource: "settings.yaml (transform)",
+		},
+		{
+			name:       "preset wins over the section",
+			settings:   "cycles: 1\ntransform:\n  cycles: 2\npresets:\n  fast:\n    cycles: 3\n",
+			preset:     "fast",
+			wantValue:  "3",
+			wantSource: "preset fast",
+		},
+		{
+			name:       "preset section wins over shared preset entries",
+			settings:   "presets:\n  fast:\n    cycles: 3\n    transform:\n      cycles: 6\n",
+			preset:     "fast",
+			wantValue:  "6",
+			wantSource: "preset fast",
+		},
+		{
+			name:       "env var wins over the preset",
+			settings:   "transform:\n  cycles: 2\npresets:\n  fast:\n    cycles: 3\n",
+			env:        map[string]string{"ART_CYCLES": "4"},
+			preset:     "fast",
+			wantValue:  "4",
+			wantSource: "ART_CYCLES",
+		},
+		{
+			name:       "command env var wins over the shared one",
+			settings:   "presets:\n  fast:\n    cycles: 3\n",
+			env:        map[string]string{"ART_CYCLES": "4", "ART_TRANSFORM_CYCLES": "5"},
+			preset:     "fast",
+			wantValue:  "5",
+			wantSource: "ART_TRANSFORM_CYCLES",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "settings.yaml")
+			if err := os.WriteFile(path, []byte(tt.settings), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			v, err := loadSettings(path)
+			if err != nil {
+				t.Fatalf("loadSettings() error = %v", err)
+			}
+			_, transform := testCommands()
+			settings, err := resolveSettings(transform, v, tt.preset)
+			if err != nil {
+				t.Fatalf("resolveSettings() error = %v", err)
+			}
+			got, ok := settings["cycles"]
+			if !ok {
+				t.Fatalf("cycles was not set")
+			}
+			if fmt.Sprint(got.value) != tt.wantValue || got.source != tt.wantSource {
+				t.Errorf("cycles = %v from %s, want %s from %s", got.value, got.source, tt.wantValue, tt.wantSource)
+			}
+			if _, ok := settings["shapes"]; ok {
+				t.Errorf("shapes was set, but nothing sets it")
+			}
+		})
+	}
+}
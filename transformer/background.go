@@ -0,0 +1,176 @@
+package transformer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/kevineaton/art/canvas"
+	"github.com/kevineaton/art/imageutils"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// BackgroundTransparent leaves the canvas empty; it requires an output format with transparency
+	BackgroundTransparent = "transparent"
+	// BackgroundSource paints the source itself under the shapes
+	BackgroundSource = "source"
+	// BackgroundBlur paints a blurred copy of the source under the shapes
+	BackgroundBlur = "blur"
+	// BackgroundDesaturate paints a blurred, grayscale copy of the source under the shapes
+	BackgroundDesaturate = "desaturate"
+	// BackgroundAverage fills the canvas with the average color of the source
+	BackgroundAverage = "average"
+)
+
+// blurFactor is how much the source is shrunk before being scaled back up to blur it
+const blurFactor = 32
+
+// averageSampleLimit caps how many pixels are read when averaging the source
+const averageSampleLimit = 250000
+
+// validateBackground makes sure the background is a known mode or a hex color and that it can be saved
+func validateBackground(background string, format imageutils.ImageFormat) error {
+	switch strings.ToLower(background) {
+	case BackgroundTransparent:
+		if !keepsAlpha(format) {
+			return fmt.Errorf("a transparent background requires png, tiff, or svg output")
+		}
+		return nil
+	case BackgroundSource, BackgroundBlur, BackgroundDesaturate, BackgroundAverage:
+		return nil
+	}
+	c, err := parseHexColor(background)
+	if err != nil {
+		return fmt.Errorf("invalid background %s; use a hex color or one of %s, %s, %s, %s, %s", background,
+			BackgroundTransparent, BackgroundSource, BackgroundBlur, BackgroundDesaturate, BackgroundAverage)
+	}
+	if _, _, _, a := c.RGBA(); a != 0xffff && !keepsAlpha(format) {
+		return fmt.Errorf("a translucent background such as %s requires png, tiff, or svg output", background)
+	}
+	return nil
+}
+
+// keepsAlpha reports whether an output format can save a canvas that is not opaque
+func keepsAlpha(format imageutils.ImageFormat) bool {
+	return format == imageutils.ImageFormatPNG || format == imageutils.ImageFormatSVG || format == imageutils.ImageFormatTIFF
+}
+
+// paintBackground prepares the canvas before any shapes are drawn
+func paintBackground(dc *gg.Context, source image.Image, background string) {
+	pixels := dc.Image().(*image.RGBA)
+	switch strings.ToLower(background) {
+	case BackgroundTransparent:
+		return
+	case BackgroundSource:
+		xdraw.ApproxBiLinear.Scale(pixels, pixels.Bounds(), source, source.Bounds(), xdraw.Src, nil)
+		return
+	case BackgroundBlur, BackgroundDesaturate:
+		blurred := blurImage(source, pixels.Bounds())
+		if strings.ToLower(background) == BackgroundDesaturate {
+			desaturate(blurred)
+		}
+		draw.Draw(pixels, pixels.Bounds(), blurred, image.Point{}, draw.Src)
+		return
+	}
+
+	dc.SetColor(backgroundColor(source, background))
+	dc.DrawRectangle(0, 0, float64(dc.Width()), float64(dc.Height()))
+	dc.Fill()
+}
+
+// paintVectorBackground copies the background of the raster canvas into the vector canvas; solid colors stay
+// vectors and image backgrounds are embedded as they were painted
+func paintVectorBackground(vector *canvas.SVG, dc *gg.Context, source image.Image, background string) {
+	c := backgroundColor(source, background)
+	if c == nil {
+		vector.DrawImage(dc.Image())
+		return
+	}
+	if _, _, _, a := c.RGBA(); a == 0 {
+		return
+	}
+	vector.SetColor(c)
+	vector.DrawRectangle(0, 0, float64(vector.Width()), float64(vector.Height()))
+	vector.Fill()
+}
+
+// backgroundColor returns the color of a solid background, or nil if the background is an image
+func backgroundColor(source image.Image, background string) color.Color {
+	switch strings.ToLower(background) {
+	case BackgroundTransparent:
+		return color.Transparent
+	case BackgroundSource, BackgroundBlur, BackgroundDesaturate:
+		return nil
+	case BackgroundAverage:
+		return averageColor(source)
+	}
+	c, err := parseHexColor(background)
+	if err != nil {
+		return color.Black
+	}
+	return c
+}
+
+// blurImage blurs the source cheaply by shrinking it and scaling it back up to the target size
+func blurImage(source image.Image, target image.Rectangle) *image.RGBA {
+	bounds := source.Bounds()
+	small := image.NewRGBA(image.Rect(0, 0, max(1, bounds.Dx()/blurFactor), max(1, bounds.Dy()/blurFactor)))
+	xdraw.ApproxBiLinear.Scale(small, small.Bounds(), source, bounds, xdraw.Src, nil)
+	out := image.NewRGBA(target)
+	xdraw.BiLinear.Scale(out, target, small, small.Bounds(), xdraw.Src, nil)
+	return out
+}
+
+// desaturate converts the image to grayscale in place
+func desaturate(img *image.RGBA) {
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		gray := uint8(0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2]))
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = gray, gray, gray
+	}
+}
+
+// averageColor is the mean color of the source
+func averageColor(source image.Image) color.Color {
+	bounds := source.Bounds()
+	step := max(1, bounds.Dx()*bounds.Dy()/averageSampleLimit)
+	var r, g, b, n int
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i++
+			if i%step != 0 {
+				continue
+			}
+			cr, cg, cb := rgb255(source.At(x, y))
+			r, g, b, n = r+cr, g+cg, b+cb, n+1
+		}
+	}
+	if n == 0 {
+		return color.Black
+	}
+	return color.RGBA{uint8(min(255, r/n)), uint8(min(255, g/n)), uint8(min(255, b/n)), 255}
+}
+
+// parseHexColor parses colors such as #fff, #ffffff, or #ffffff80, with or without the leading #
+func parseHexColor(input string) (color.Color, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(input), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return nil, fmt.Errorf("invalid hex color %s", input)
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex color %s", input)
+	}
+	return color.NRGBA{uint8(value >> 24), uint8(value >> 16), uint8(value >> 8), uint8(value)}, nil
+}
@@ -0,0 +1,36 @@
+package transformer
+
+import (
+	"testing"
+
+	"github.com/kevineaton/art/imageutils"
+)
+
+func TestValidateBackground(t *testing.T) {
+	tests := []struct {
+		background string
+		format     imageutils.ImageFormat
+		wantErr    bool
+	}{
+		{"#102030", imageutils.ImageFormatJPG, false},
+		{"#abc", imageutils.ImageFormatBMP, false},
+		{"#102030ff", imageutils.ImageFormatGIF, false},
+		{"#10203080", imageutils.ImageFormatPNG, false},
+		{"#10203080", imageutils.ImageFormatTIFF, false},
+		{"#10203080", imageutils.ImageFormatSVG, false},
+		{"#10203080", imageutils.ImageFormatJPG, true},
+		{"#10203080", imageutils.ImageFormatBMP, true},
+		{"#10203080", imageutils.ImageFormatGIF, true},
+		{"transparent", imageutils.ImageFormatTIFF, false},
+		{"transparent", imageutils.ImageFormatJPG, true},
+		{"blur", imageutils.ImageFormatJPG, false},
+		{"#12345", imageutils.ImageFormatPNG, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.background+"_"+string(tt.format), func(t *testing.T) {
+			if err := validateBackground(tt.background, tt.format); (err != nil) != tt.wantErr {
+				t.Errorf("validateBackground() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+)
+
+// checkpointVersion is bumped whenever the checkpoint format changes in a way older files cannot be read
+const checkpointVersion = 1
+
+// checkpointExtension is added to the output name to get the name of the checkpoint file
+const checkpointExtension = ".checkpoint"
+
+// checkpoint is everything needed to pick a sketch back up exactly where it left off
+type checkpoint struct {
+	Version        int
+	InputPath      string
+	InputName      string
+	OutputName     string
+	Params         TransformerUserParams
+	Original       TransformerUserParams
+	Crop           image.Rectangle
+	Cycle          int
+	ScheduleCycles int
+	StrokeSize     float64
+	RNG            []byte
+	Sampler        []byte
+	Canvas         []byte
+	Vector         []byte
+	ShapeLog       string
+	ShapeLogOffset int64
+}
+
+// statefulSampler is implemented by samplers that remember where they have been
+type statefulSampler interface {
+	saveState() ([]byte, error)
+	loadState(data []byte) error
+}
+
+// saveCheckpoint writes the state of the sketch; the file is replaced in one step so an interruption while
+// saving never leaves a broken checkpoint behind
+func saveCheckpoint(path string, s *TransformerSketch, job transformJob) error {
+	cp := &checkpoint{
+		Version:        checkpointVersion,
+		InputPath:      absolutePath(job.inputPath),
+		InputName:      job.inputName,
+		OutputName:     job.outputName,
+		Params:         *s.TransformerUserParams,
+		Original:       s.original,
+		Crop:           s.crop,
+		Cycle:          s.cycle,
+		ScheduleCycles: s.scheduleCycles,
+		StrokeSize:     s.strokeSize,
+	}
+	cp.Params.Resume, cp.Params.Extend = "", 0
+	// the masks are found again when resuming, which may be from another directory
+	cp.Params.Mask, cp.Params.MaskDir = absolutePath(cp.Params.Mask), absolutePath(cp.Params.MaskDir)
+	cp.Original.Resume, cp.Original.Extend = "", 0
+	var err error
+	if cp.RNG, err = s.pcg.MarshalBinary(); err != nil {
+		return fmt.Errorf("could not save the random generator: %w", err)
+	}
+	if stateful, ok := s.sampler.(statefulSampler); ok {
+		if cp.Sampler, err = stateful.saveState(); err != nil {
+			return fmt.Errorf("could not save the sampler: %w", err)
+		}
+	}
+	canvas := &bytes.Buffer{}
+	if err := png.Encode(canvas, s.dc.Image()); err != nil {
+		return fmt.Errorf("could not save the canvas: %w", err)
+	}
+	cp.Canvas = canvas.Bytes()
+	if s.shapeLog != nil {
+		cp.ShapeLog = absolutePath(job.shapeLogPath)
+		if cp.ShapeLogOffset, err = s.shapeLog.offset(); err != nil {
+			return fmt.Errorf("could not save the shape log: %w", err)
+		}
+	}
+	if s.vector != nil {
+		if cp.Vector, err = s.vector.MarshalBinary(); err != nil {
+			return fmt.Errorf("could not save the vector canvas: %w", err)
+		}
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("could not save the checkpoint: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not save the checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not save the checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not save the checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not save the checkpoint: %w", err)
+	}
+	return nil
+}
+
+// loadCheckpoint reads a checkpoint from disk
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the checkpoint: %w", err)
+	}
+	cp := &checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("could not read the checkpoint: %w", err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("the checkpoint is version %d but only version %d is supported", cp.Version, checkpointVersion)
+	}
+	return cp, nil
+}
+
+// restoreSketch rebuilds a sketch from a checkpoint and the source and mask it was based on. The canvas is
+// rebuilt from the saved crop and size rather than the params, so the scale and presets are not applied a
+// second time
+func restoreSketch(cp *checkpoint, source image.Image, mask *weightMap, config *sketchConfig) (*TransformerSketch, error) {
+	if !cp.Crop.In(source.Bounds()) {
+		return nil, errors.New("the source no longer matches the checkpoint")
+	}
+
+	params := &TransformerUserParams{}
+	*params = cp.Params
+
+	// the sampler is sized for the original run, so build it before any extension is added back
+	params.TotalCycles = cp.ScheduleCycles
+	s := buildSketch(source, mask, cp.Crop, params.DestWidth, params.DestHeight, params, config)
+	s.TotalCycles = cp.Params.TotalCycles
+	s.StrokeJitter = cp.Params.StrokeJitter
+	s.original = cp.Original
+	s.cycle = cp.Cycle
+	s.strokeSize = cp.StrokeSize
+	if err := s.pcg.UnmarshalBinary(cp.RNG); err != nil {
+		return nil, fmt.Errorf("could not restore the random generator: %w", err)
+	}
+	if stateful, ok := s.sampler.(statefulSampler); ok && len(cp.Sampler) > 0 {
+		if err := stateful.loadState(cp.Sampler); err != nil {
+			return nil, fmt.Errorf("could not restore the sampler: %w", err)
+		}
+	}
+	canvas, err := png.Decode(bytes.NewReader(cp.Canvas))
+	if err != nil {
+		return nil, fmt.Errorf("could not restore the canvas: %w", err)
+	}
+	if canvas.Bounds() != s.dc.Image().Bounds() {
+		return nil, errors.New("the canvas in the checkpoint does not match its params")
+	}
+	draw.Draw(s.dc.Image().(*image.RGBA), canvas.Bounds(), canvas, image.Point{}, draw.Src)
+	if s.vector != nil && cp.Vector != nil {
+		if err := s.vector.UnmarshalBinary(cp.Vector); err != nil {
+			return nil, fmt.Errorf("could not restore the vector canvas: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// absolutePath resolves a path so a checkpoint can be resumed from another directory; stdin and paths that
+// were not set are kept as they are
+func absolutePath(path string) string {
+	if path == stdio || path == "" {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// newPCG creates the generator for a seed; it is kept separately from the rand.Rand so it can be saved
+func newPCG(seed int64) (*rand.PCG, *rand.Rand) {
+	pcg := rand.NewPCG(uint64(seed), uint64(seed))
+	return pcg, rand.New(pcg)
+}
+
+// gridSamplerState is the saved form of a gridSampler
+type gridSamplerState struct {
+	Order []int
+}
+
+func (g *gridSampler) saveState() ([]byte, error) {
+	return json.Marshal(gridSamplerState{Order: g.order})
+}
+
+func (g *gridSampler) loadState(data []byte) error {
+	state := gridSamplerState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	g.order = state.Order
+	return nil
+}
+
+// poissonSamplerState is the saved form of a poissonSampler
+type poissonSamplerState struct {
+	CellSize float64
+	Points   [][2]float64
+}
+
+func (p *poissonSampler) saveState() ([]byte, error) {
+	state := poissonSamplerState{CellSize: p.cellSize}
+	for _, cell := range p.grid {
+		for _, point := range cell {
+			state.Points = append(state.Points, [2]float64{point.x, point.y})
+		}
+	}
+	return json.Marshal(state)
+}
+
+func (p *poissonSampler) loadState(data []byte) error {
+	state := poissonSamplerState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if state.CellSize <= 0 {
+		return nil
+	}
+	p.newLayer(state.CellSize * 2)
+	for _, point := range state.Points {
+		p.add(point[0], point[1])
+	}
+	return nil
+}
+
+// maskedSampler saves whatever it wraps
+func (m *maskedSampler) saveState() ([]byte, error) {
+	if stateful, ok := m.inner.(statefulSampler); ok {
+		return stateful.saveState()
+	}
+	return nil, nil
+}
+
+func (m *maskedSampler) loadState(data []byte) error {
+	if stateful, ok := m.inner.(statefulSampler); ok {
+		return stateful.loadState(data)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.RGBA{40, 120, 200, 255}), image.Point{}, draw.Src)
+	sketch, err := runTransform(context.Background(), src, WithSize(40, 30), WithCycles(50), WithSeed(7), WithShapeLog(&bytes.Buffer{}))
+	if err != nil {
+		t.Fatalf("runTransform() error = %v", err)
+	}
+
+	sketch.TransformerUserParams.Mask = "mask.png"
+	path := filepath.Join(t.TempDir(), "a.checkpoint")
+	job := transformJob{inputName: "a.png", inputPath: filepath.Join("input", "a.png"), outputName: "a_out.png", shapeLogPath: filepath.Join("output", "a_out.shapes.jsonl")}
+	if err := saveCheckpoint(path, sketch, job); err != nil {
+		t.Fatalf("saveCheckpoint() error = %v", err)
+	}
+	cp, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("loadCheckpoint() error = %v", err)
+	}
+	if cp.Params.MaskDir != "" {
+		t.Errorf("MaskDir = %s, want it left unset", cp.Params.MaskDir)
+	}
+	for name, got := range map[string]string{"InputPath": cp.InputPath, "ShapeLog": cp.ShapeLog, "Mask": cp.Params.Mask} {
+		if !filepath.IsAbs(got) {
+			t.Errorf("%s = %s, want an absolute path", name, got)
+		}
+	}
+	if want, _ := filepath.Abs(job.inputPath); cp.InputPath != want {
+		t.Errorf("InputPath = %s, want %s", cp.InputPath, want)
+	}
+
+	restored, err := restoreSketch(cp, src, nil, sketch.sketchConfig)
+	if err != nil {
+		t.Fatalf("restoreSketch() error = %v", err)
+	}
+	if restored.cycle != sketch.cycle {
+		t.Errorf("cycle = %d, want %d", restored.cycle, sketch.cycle)
+	}
+	if !bytes.Equal(restored.dc.Image().(*image.RGBA).Pix, sketch.dc.Image().(*image.RGBA).Pix) {
+		t.Errorf("the restored canvas does not match the saved one")
+	}
+	if restored.rng.Uint64() != sketch.rng.Uint64() {
+		t.Errorf("the restored random generator does not continue where the saved one left off")
+	}
+}
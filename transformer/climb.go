@@ -0,0 +1,108 @@
+package transformer
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/fogleman/gg"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// ModePaint draws every shape that is generated
+	ModePaint = "paint"
+	// ModeClimb only draws shapes that bring the canvas closer to the source
+	ModeClimb = "climb"
+)
+
+// climber scores candidate shapes against the source so only improvements are committed
+type climber struct {
+	steps     int
+	target    *image.RGBA
+	scratch   *image.RGBA
+	scratchDC *gg.Context
+}
+
+// newClimber prepares the source at the size of the canvas along with a scratch canvas to try shapes on. The
+// scratch canvas is clipped like the real one, so shapes are only scored on what they would actually paint
+func newClimber(source image.Image, width, height, steps int, clip *image.Alpha) *climber {
+	target := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.ApproxBiLinear.Scale(target, target.Bounds(), source, source.Bounds(), xdraw.Src, nil)
+	scratch := image.NewRGBA(target.Bounds())
+	scratchDC := gg.NewContextForRGBA(scratch)
+	if clip != nil {
+		scratchDC.SetMask(clip)
+	}
+	return &climber{
+		steps:     steps,
+		target:    target,
+		scratch:   scratch,
+		scratchDC: scratchDC,
+	}
+}
+
+// improve scores the candidate and, if enabled, mutates it to find a better fit. It returns the best shape
+// found or nil if none of them improve the canvas
+func (c *climber) improve(s *TransformerSketch, shape Shape, r, g, b int) (Shape, int, int, int) {
+	bestScore := c.score(s, shape, r, g, b)
+	best, bestR, bestG, bestB := shape, r, g, b
+	for i := 0; i < c.steps; i++ {
+		candidate := best.Mutate(s.rng, s.strokeSize/2)
+		cx, cy := center(candidate.Bounds())
+		cr, cg, cb := s.colorAt(cx, cy)
+		if score := c.score(s, candidate, cr, cg, cb); score > bestScore {
+			best, bestR, bestG, bestB, bestScore = candidate, cr, cg, cb, score
+		}
+	}
+	if bestScore <= 0 {
+		return nil, 0, 0, 0
+	}
+	return best, bestR, bestG, bestB
+}
+
+// score returns how much the total squared error of the canvas drops if the shape is drawn
+func (c *climber) score(s *TransformerSketch, shape Shape, r, g, b int) float64 {
+	bounds := shape.Bounds().Intersect(c.target.Bounds())
+	if bounds.Empty() {
+		return 0
+	}
+	canvas := s.dc.Image().(*image.RGBA)
+	draw.Draw(c.scratch, bounds, canvas, bounds.Min, draw.Src)
+	s.drawShape(c.scratchDC, shape, r, g, b)
+	return squaredError(canvas, c.target, bounds) - squaredError(c.scratch, c.target, bounds)
+}
+
+// similarity compares two images of the same size, where 1 is identical
+func similarity(a, b *image.RGBA) float64 {
+	bounds := a.Bounds()
+	pixels := float64(bounds.Dx() * bounds.Dy() * 3)
+	if pixels == 0 {
+		return 0
+	}
+	rmse := math.Sqrt(squaredError(a, b, bounds) / pixels)
+	return 1 - rmse/255
+}
+
+// squaredError sums the squared differences of the color channels in the region
+func squaredError(a, b *image.RGBA, bounds image.Rectangle) float64 {
+	total := 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		i := a.PixOffset(bounds.Min.X, y)
+		j := b.PixOffset(bounds.Min.X, y)
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for k := 0; k < 3; k++ {
+				d := float64(a.Pix[i+k]) - float64(b.Pix[j+k])
+				total += d * d
+			}
+			i += 4
+			j += 4
+		}
+	}
+	return total
+}
+
+// center returns the middle of a rectangle
+func center(r image.Rectangle) (float64, float64) {
+	return float64(r.Min.X+r.Max.X) / 2, float64(r.Min.Y+r.Max.Y) / 2
+}
@@ -0,0 +1,198 @@
+package transformer
+
+import (
+	"image"
+	"math"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/kevineaton/art/canvas"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// defaultGlyphs is used when the user does not provide any characters for the glyph shape
+const defaultGlyphs = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// glyphScale is the size glyph outlines are loaded at before being normalized
+const glyphScale = 1024
+
+// Glyph is a single character from the Go font, drawn as an outline so it can be filled and stroked
+// like any other shape
+type Glyph struct {
+	X, Y     float64
+	Size     float64
+	Rotation float64
+	Rune     rune
+}
+
+// glyphOp is a single step of a normalized glyph outline
+type glyphOp struct {
+	move bool
+	quad bool
+	cx   float64
+	cy   float64
+	x    float64
+	y    float64
+}
+
+var (
+	glyphFont     *truetype.Font
+	glyphFontErr  error
+	glyphFontOnce sync.Once
+	glyphCache    = map[rune][]glyphOp{}
+	glyphCacheMu  sync.Mutex
+)
+
+func newGlyph(rng *rand.Rand, params *TransformerUserParams, x, y, size, rotation float64) Shape {
+	choices := []rune(params.Glyphs)
+	if len(choices) == 0 {
+		choices = []rune(defaultGlyphs)
+	}
+	return &Glyph{X: x, Y: y, Size: 2 * size, Rotation: rotation, Rune: choices[rng.IntN(len(choices))]}
+}
+
+func (g *Glyph) Path(dc canvas.Canvas) {
+	for i, op := range glyphOutline(g.Rune) {
+		p := rotatePoint(op.x*g.Size, op.y*g.Size, g.Rotation, g.X, g.Y)
+		switch {
+		case op.move:
+			if i > 0 {
+				dc.ClosePath()
+			}
+			dc.NewSubPath()
+			dc.MoveTo(p.X, p.Y)
+		case op.quad:
+			c := rotatePoint(op.cx*g.Size, op.cy*g.Size, g.Rotation, g.X, g.Y)
+			dc.QuadraticTo(c.X, c.Y, p.X, p.Y)
+		default:
+			dc.LineTo(p.X, p.Y)
+		}
+	}
+	dc.ClosePath()
+}
+
+func (g *Glyph) BrushWidth() float64 {
+	return 0
+}
+
+func (g *Glyph) Bounds() image.Rectangle {
+	// outlines are normalized so the larger side is 1, so half the diagonal always contains them
+	return boundsAround(g.X, g.Y, g.Size*math.Sqrt2/2)
+}
+
+func (g *Glyph) Mutate(rng *rand.Rand, amount float64) Shape {
+	m := *g
+	m.X, m.Y = mutatePoint(rng, m.X, m.Y, amount)
+	m.Size = mutateLength(rng, m.Size, amount)
+	m.Rotation += rng.NormFloat64() * 0.3
+	return &m
+}
+
+// glyphOutline loads the outline of a rune, centered on the origin and scaled so the larger side is 1
+func glyphOutline(r rune) []glyphOp {
+	glyphCacheMu.Lock()
+	defer glyphCacheMu.Unlock()
+	if ops, ok := glyphCache[r]; ok {
+		return ops
+	}
+
+	if _, err := loadGoFont(); err != nil {
+		return nil
+	}
+
+	buf := &truetype.GlyphBuf{}
+	if err := buf.Load(glyphFont, fixed.I(glyphScale), glyphFont.Index(r), font.HintingNone); err != nil || len(buf.Points) == 0 {
+		glyphCache[r] = nil
+		return nil
+	}
+
+	// center the bounding box and flip the y axis, since font units grow upwards
+	minX, minY := float64(buf.Bounds.Min.X)/64, float64(buf.Bounds.Min.Y)/64
+	maxX, maxY := float64(buf.Bounds.Max.X)/64, float64(buf.Bounds.Max.Y)/64
+	scale := max(maxX-minX, maxY-minY)
+	if scale <= 0 {
+		scale = glyphScale
+	}
+	cx, cy := (minX+maxX)/2, (minY+maxY)/2
+	normalize := func(p truetype.Point) (float64, float64, bool) {
+		return (float64(p.X)/64 - cx) / scale, -(float64(p.Y)/64 - cy) / scale, p.Flags&1 == 1
+	}
+
+	ops := []glyphOp{}
+	start := 0
+	for _, end := range buf.Ends {
+		ops = append(ops, contourOps(buf.Points[start:end], normalize)...)
+		start = end
+	}
+	glyphCache[r] = ops
+	return ops
+}
+
+// contourOps converts a TrueType contour, where consecutive off curve points imply an on curve point
+// between them, into move, line, and quadratic steps
+func contourOps(points []truetype.Point, normalize func(truetype.Point) (float64, float64, bool)) []glyphOp {
+	n := len(points)
+	if n == 0 {
+		return nil
+	}
+	type point struct {
+		x, y float64
+		on   bool
+	}
+	pts := make([]point, n)
+	for i := range points {
+		pts[i].x, pts[i].y, pts[i].on = normalize(points[i])
+	}
+
+	// find a starting point that is on the curve, creating one if every point is off the curve
+	first := -1
+	for i := range pts {
+		if pts[i].on {
+			first = i
+			break
+		}
+	}
+	var startX, startY float64
+	if first >= 0 {
+		startX, startY = pts[first].x, pts[first].y
+	} else {
+		startX, startY = (pts[0].x+pts[n-1].x)/2, (pts[0].y+pts[n-1].y)/2
+		first = n - 1
+	}
+
+	ops := []glyphOp{{move: true, x: startX, y: startY}}
+	var control *point
+	for step := 1; step <= n; step++ {
+		p := pts[(first+step)%n]
+		if p.on {
+			if control != nil {
+				ops = append(ops, glyphOp{quad: true, cx: control.x, cy: control.y, x: p.x, y: p.y})
+				control = nil
+			} else {
+				ops = append(ops, glyphOp{x: p.x, y: p.y})
+			}
+			continue
+		}
+		if control != nil {
+			mx, my := (control.x+p.x)/2, (control.y+p.y)/2
+			ops = append(ops, glyphOp{quad: true, cx: control.x, cy: control.y, x: mx, y: my})
+		}
+		c := p
+		control = &c
+	}
+	if control != nil {
+		ops = append(ops, glyphOp{quad: true, cx: control.x, cy: control.y, x: startX, y: startY})
+	}
+	return ops
+}
+
+// loadGoFont parses the Go font the first time it is needed, for glyph shapes and for text such as labels
+func loadGoFont() (*truetype.Font, error) {
+	glyphFontOnce.Do(func() {
+		glyphFont, glyphFontErr = truetype.Parse(goregular.TTF)
+	})
+	return glyphFont, glyphFontErr
+}
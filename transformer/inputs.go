@@ -0,0 +1,214 @@
+package transformer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kevineaton/art/imageutils"
+)
+
+// stdio is passed as an input to read from stdin, or as the output to write to stdout
+const stdio = "-"
+
+// stdinName is used in place of a file name when naming the output of an image read from stdin
+const stdinName = "stdin.png"
+
+// source is an image to transform
+type source struct {
+	path string
+	name string
+	// subdir is where the image sits below the directory it was found in, which is mirrored in the output
+	subdir string
+}
+
+// destination is where the outputs of a run are written
+type destination struct {
+	dir string
+	// file is set when the output is a single file rather than a directory
+	file   string
+	stdout bool
+}
+
+// findSources expands the inputs, which may each be a file, a directory, a glob, or stdin, into the images
+// to transform. Directories and globs only pick up files whose contents are an image, and the others are
+// returned so they can be reported, while files that are named directly are always used
+func findSources(inputs []string, recursive bool) ([]source, []string, error) {
+	sources := []source{}
+	skipped := []string{}
+	seen := map[string]bool{}
+	add := func(s source) {
+		if key := filepath.Clean(s.path); !seen[key] {
+			seen[key] = true
+			sources = append(sources, s)
+		}
+	}
+	for _, input := range inputs {
+		if input == stdio {
+			add(source{path: stdio, name: stdinName})
+			continue
+		}
+		info, err := os.Stat(input)
+		if err == nil {
+			if !info.IsDir() {
+				add(source{path: input, name: filepath.Base(input)})
+				continue
+			}
+			found, notImages, err := findInDirectory(input, recursive)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, s := range found {
+				add(s)
+			}
+			skipped = append(skipped, notImages...)
+			continue
+		}
+		if !strings.ContainsAny(input, "*?[") {
+			return nil, nil, fmt.Errorf("could not find the input: %w", err)
+		}
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid input pattern %s: %w", input, err)
+		}
+		if len(matches) == 0 {
+			return nil, nil, fmt.Errorf("no files match the input %s", input)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not read the input: %w", err)
+			}
+			if !info.IsDir() {
+				if isSourceImage(match) {
+					add(source{path: match, name: filepath.Base(match)})
+				} else if !isHidden(match) {
+					skipped = append(skipped, match)
+				}
+				continue
+			}
+			found, notImages, err := findInDirectory(match, recursive)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, s := range found {
+				add(s)
+			}
+			skipped = append(skipped, notImages...)
+		}
+	}
+	return sources, skipped, nil
+}
+
+// findInDirectory lists the images in a directory, and in every directory below it when recursive, along
+// with the files that are not images
+func findInDirectory(dir string, recursive bool) ([]source, []string, error) {
+	sources := []source{}
+	skipped := []string{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isSourceImage(path) {
+			if !isHidden(path) {
+				skipped = append(skipped, path)
+			}
+			return nil
+		}
+		subdir, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		sources = append(sources, source{path: path, name: entry.Name(), subdir: subdir})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read the input directory %s: %w", dir, err)
+	}
+	return sources, skipped, nil
+}
+
+// isSourceImage checks whether a file found in a directory or glob is an image that can be decoded, going by
+// its contents rather than its name
+func isSourceImage(path string) bool {
+	_, err := imageutils.DetectFormat(path)
+	return err == nil
+}
+
+// isHidden checks for files such as .DS_Store, which are left out without being reported as skipped
+func isHidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// reportSkipped lists the files that were left out because they are not images
+func reportSkipped(out io.Writer, skipped []string) {
+	for _, path := range skipped {
+		fmt.Fprintf(out, "%s: skipped, since it is not an image that can be read\n", path)
+	}
+}
+
+// findDestination works out whether the output is a directory, a single file, or stdout. An output that does
+// not exist yet is taken as a file if it has an image extension and as a directory otherwise
+func findDestination(output string, sources []source) (destination, error) {
+	if output == "" {
+		output = "./output"
+	}
+	if output == stdio {
+		if len(sources) != 1 {
+			return destination{}, errors.New("only one input can be written to stdout")
+		}
+		return destination{dir: ".", stdout: true}, nil
+	}
+	info, err := os.Stat(output)
+	isFile := err == nil && !info.IsDir()
+	if err != nil {
+		_, formatErr := imageutils.GetImageFormatFromString(strings.TrimPrefix(filepath.Ext(output), "."))
+		isFile = formatErr == nil
+	}
+	if !isFile {
+		return destination{dir: output}, nil
+	}
+	if len(sources) != 1 {
+		return destination{}, fmt.Errorf("the output %s is a file, so only one input can be given", output)
+	}
+	return destination{dir: filepath.Dir(output), file: filepath.Base(output)}, nil
+}
+
+// loadSource loads an image from a file, or from stdin, along with the hash of its bytes
+func loadSource(path string) (image.Image, string, error) {
+	var data []byte
+	var err error
+	if path == stdio {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("could not load image: %w", err)
+	}
+	img, err := imageutils.DecodeImage(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return img, sourceHash(data), nil
+}
+
+// reportWriter is where messages and progress go; when the image itself is written to stdout they move to
+// stderr so they do not end up in the image
+func reportWriter(params *TransformerUserParams) io.Writer {
+	if params.Output == stdio {
+		return os.Stderr
+	}
+	return os.Stdout
+}
@@ -0,0 +1,58 @@
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kevineaton/art/imageutils"
+	"github.com/spf13/cobra"
+)
+
+// GetInspectCommand returns the command that prints the metadata saved in an output
+func GetInspectCommand() *cobra.Command {
+	asJSON := false
+	cmd := &cobra.Command{
+		Use:   "inspect <file>",
+		Short: "Show how an image made by art was generated",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := Inspect(args[0], asJSON); err != nil {
+				return commandError(cmd, os.Stdout, err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the metadata as a JSON object instead of one entry per line")
+	return cmd
+}
+
+// Inspect prints the metadata of a png or jpg
+func Inspect(path string, asJSON bool) error {
+	metadata, err := imageutils.ReadMetadata(path)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(metadata)
+	}
+	if len(metadata) == 0 {
+		fmt.Printf("%s has no metadata\n", path)
+		return nil
+	}
+	for _, key := range metadata.Keys() {
+		value := metadata[key]
+		if key == MetadataParams {
+			// the params are a single line of JSON, which is easier to read spread out
+			indented := &bytes.Buffer{}
+			if json.Indent(indented, []byte(value), "", "  ") == nil {
+				value = indented.String()
+			}
+		}
+		fmt.Printf("%s: %s\n", key, value)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package transformer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// maskAttempts is how many locations a masked sampler tries before giving up on a cycle
+const maskAttempts = 50
+
+// weightMap is a grayscale mask the size of the source, where white areas are painted normally, darker areas
+// get fewer and larger shapes, and black areas are not painted at all
+type weightMap struct {
+	gray *image.Gray
+}
+
+// findMask returns the mask for an input: a file in the mask directory with the same name as the input
+// takes priority over the global mask. An empty string means there is no mask
+func findMask(inputName string, params *TransformerUserParams) string {
+	if params.MaskDir != "" {
+		base := strings.TrimSuffix(inputName, filepath.Ext(inputName))
+		for _, extension := range []string{".png", ".jpg", ".jpeg"} {
+			path := filepath.Join(params.MaskDir, base+extension)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return params.Mask
+}
+
+// newWeightMap stretches a mask over the bounds of the source
+func newWeightMap(img image.Image, sourceBounds image.Rectangle) *weightMap {
+	gray := image.NewGray(sourceBounds)
+	xdraw.ApproxBiLinear.Scale(gray, sourceBounds, img, img.Bounds(), xdraw.Src, nil)
+	return &weightMap{gray: gray}
+}
+
+// crop keeps the same region that was kept from the source
+func (m *weightMap) crop(crop image.Rectangle) *weightMap {
+	gray := image.NewGray(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	xdraw.Copy(gray, image.Point{}, m.gray, crop, xdraw.Src, nil)
+	return &weightMap{gray: gray}
+}
+
+// at returns the weight from 0 to 1 at a location in source pixels
+func (m *weightMap) at(x, y float64) float64 {
+	bounds := m.gray.Bounds()
+	px := max(bounds.Min.X, min(int(x), bounds.Max.X-1))
+	py := max(bounds.Min.Y, min(int(y), bounds.Max.Y-1))
+	return float64(m.gray.GrayAt(px, py).Y) / 255
+}
+
+// clip is a mask for a canvas of the given size that hides the black areas, so shapes that are centered in a
+// lit area still do not paint across them
+func (m *weightMap) clip(width, height int) *image.Alpha {
+	return clipMask(m.gray, width, height)
+}
+
+// encode writes the weight map as a png, so a shape log can carry it
+func (m *weightMap) encode() ([]byte, error) {
+	encoded := &bytes.Buffer{}
+	if err := png.Encode(encoded, m.gray); err != nil {
+		return nil, fmt.Errorf("could not encode the mask: %w", err)
+	}
+	return encoded.Bytes(), nil
+}
+
+// clipMask stretches a grayscale mask over a canvas, keeping everything that is not black
+func clipMask(gray *image.Gray, width, height int) *image.Alpha {
+	bounds := gray.Bounds()
+	alpha := image.NewAlpha(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			if gray.GrayAt(bounds.Min.X+x*bounds.Dx()/width, sy).Y > 0 {
+				alpha.Pix[alpha.PixOffset(x, y)] = 255
+			}
+		}
+	}
+	return alpha
+}
+
+// strokeMultiplier grows the stroke where the weight is low; scale is the multiplier at a weight of 0
+func (m *weightMap) strokeMultiplier(x, y, scale float64) float64 {
+	return 1 + (scale-1)*(1-m.at(x, y))
+}
+
+// maskedSampler rejects locations from another sampler in proportion to how dark the mask is there
+type maskedSampler struct {
+	inner sampler
+	mask  *weightMap
+}
+
+func (m *maskedSampler) next(rng *rand.Rand, radius float64) (float64, float64) {
+	var x, y float64
+	for attempt := 0; attempt < maskAttempts; attempt++ {
+		x, y = m.inner.next(rng, radius)
+		if rng.Float64() < m.mask.at(x, y) {
+			break
+		}
+	}
+	return x, y
+}
@@ -0,0 +1,93 @@
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+// halfMask is black on the left half and white on the right
+func halfMask(width, height int) *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, width, height))
+	draw.Draw(mask, image.Rect(width/2, 0, width, height), image.White, image.Point{}, draw.Src)
+	return mask
+}
+
+func TestMaskClipsShapes(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.RGBA{200, 30, 30, 255}), image.Point{}, draw.Src)
+
+	params := DefaultParams()
+	params.Background = "#0000ff"
+	params.StrokeRatio = 0.5
+	params.TotalCycles = 300
+	img, err := Transform(context.Background(), src, WithParams(params), WithSize(100, 100), WithMask(halfMask(100, 100)))
+	if err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+
+	background := color.RGBA{0, 0, 255, 255}
+	painted := false
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			if x < 50 && c != background {
+				t.Fatalf("pixel %d,%d under the black half of the mask is %v, want the background %v", x, y, c, background)
+			}
+			if x >= 50 && c != background {
+				painted = true
+			}
+		}
+	}
+	if !painted {
+		t.Errorf("nothing was painted under the white half of the mask")
+	}
+}
+
+func TestMaskClipsVector(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 60, 60))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.RGBA{200, 30, 30, 255}), image.Point{}, draw.Src)
+
+	params := DefaultParams()
+	params.TotalCycles = 20
+	sketch, err := runTransform(context.Background(), src, WithParams(params), WithSize(60, 60), WithOutputType("svg"), WithMask(halfMask(60, 60)))
+	if err != nil {
+		t.Fatalf("runTransform() error = %v", err)
+	}
+	out := &bytes.Buffer{}
+	if _, err := sketch.vector.WriteTo(out); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if !strings.Contains(out.String(), `<mask id="mask"`) || !strings.Contains(out.String(), `<g mask="url(#mask)">`) {
+		t.Errorf("the svg does not clip its shapes to the mask")
+	}
+}
+
+func TestMaskClipsClimbScore(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.RGBA{200, 30, 30, 255}), image.Point{}, draw.Src)
+
+	params := DefaultParams()
+	params.Background = "#0000ff"
+	params.Mode = ModeClimb
+	params.InitialAlpha = 255
+	params.TotalCycles = 1
+	sketch, err := runTransform(context.Background(), src, WithParams(params), WithSize(100, 100), WithMask(halfMask(100, 100)))
+	if err != nil {
+		t.Fatalf("runTransform() error = %v", err)
+	}
+	// a shape in the color of the source would bring the black half closer to it, if it could paint there
+	hidden := &Ellipse{X: 20, Y: 50, RadiusX: 15, RadiusY: 15}
+	if score := sketch.climb.score(sketch, hidden, 200, 30, 30); score != 0 {
+		t.Errorf("score() = %v for a shape under the black half of the mask, want 0", score)
+	}
+	visible := &Ellipse{X: 80, Y: 50, RadiusX: 15, RadiusY: 15}
+	if score := sketch.climb.score(sketch, visible, 200, 30, 30); score <= 0 {
+		t.Errorf("score() = %v for a shape under the white half of the mask, want an improvement", score)
+	}
+}
@@ -0,0 +1,92 @@
+package transformer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/kevineaton/art/imageutils"
+)
+
+// the keys written into the metadata of outputs
+const (
+	MetadataSoftware     = "Software"
+	MetadataVersion      = "art:version"
+	MetadataCommand      = "art:command"
+	MetadataParams       = "art:params"
+	MetadataSeed         = "art:seed"
+	MetadataCycles       = "art:cycles"
+	MetadataSource       = "art:source"
+	MetadataSourceSHA256 = "art:source-sha256"
+	MetadataShapeLog     = "art:shape-log"
+)
+
+// newMetadata describes how the canvas of a sketch was made, so the output can be traced back and reproduced
+func newMetadata(s *TransformerSketch) imageutils.Metadata {
+	params := s.original
+	params.Resume, params.Extend = "", 0
+	encoded, _ := json.Marshal(params)
+	version := toolVersion()
+	return imageutils.Metadata{
+		MetadataSoftware: "art " + version,
+		MetadataVersion:  version,
+		MetadataParams:   string(encoded),
+		MetadataSeed:     strconv.FormatInt(s.Seed, 10),
+		MetadataCycles:   strconv.Itoa(s.cycle),
+	}
+}
+
+// toolVersion is the module version art was built at, or the commit for builds from a checkout
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// commandLine is the command that was run, quoted so it can be pasted back into a shell
+func commandLine() string {
+	args := make([]string, len(os.Args))
+	for i, arg := range os.Args {
+		if i == 0 {
+			arg = "art"
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;#~") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		args[i] = arg
+	}
+	return strings.Join(args, " ")
+}
+
+// sourceHash is the SHA-256 of the bytes of a source
+func sourceHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,173 @@
+package transformer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// OnExistsIncrement adds a number to the name until it is free
+	OnExistsIncrement = "increment"
+	// OnExistsOverwrite replaces the existing file
+	OnExistsOverwrite = "overwrite"
+	// OnExistsSkip leaves the existing file and does not transform the input
+	OnExistsSkip = "skip"
+)
+
+// defaultNameTemplate is how outputs have always been named
+const defaultNameTemplate = "{name}_{date}_{cycles}cycles_seed{seed}_transformed"
+
+// paramAliases are the placeholders for flags that are named differently from their param
+var paramAliases = map[string]string{
+	"cycles":      "TotalCycles",
+	"min-edges":   "MinEdgeCount",
+	"max-edges":   "MaxEdgeCount",
+	"output-type": "OutputFileType",
+	"animation":   "AnimationType",
+	"input":       "Inputs",
+}
+
+// nameTemplate is a parsed --name-template; parts alternate between literal text and placeholders, starting
+// with text
+type nameTemplate struct {
+	parts []string
+}
+
+// parseNameTemplate checks that every placeholder in a template is known. Placeholders are {name} for the
+// source without its extension, {date}, {seq} for the position of the input in the run, and any param by the
+// name of its flag, such as {seed}, {cycles}, or {stroke-ratio}
+func parseNameTemplate(template string) (*nameTemplate, error) {
+	if template == "" {
+		template = defaultNameTemplate
+	}
+	t := &nameTemplate{}
+	rest := template
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, rest)
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("the name template %s has a { without a matching }", template)
+		}
+		placeholder := rest[open+1 : open+end]
+		switch placeholder {
+		case "name", "date", "seq":
+		default:
+			if _, ok := paramField(placeholder); !ok {
+				return nil, fmt.Errorf("unknown placeholder {%s} in the name template", placeholder)
+			}
+		}
+		t.parts = append(t.parts, rest[:open], placeholder)
+		rest = rest[open+end+1:]
+	}
+	for i := 0; i < len(t.parts); i += 2 {
+		if strings.ContainsAny(t.parts[i], `/\`) {
+			return nil, errors.New("the name template cannot contain directories; use --output instead")
+		}
+	}
+	return t, nil
+}
+
+// execute names the output for an input, adding the extension of the output type
+func (t *nameTemplate) execute(inputName, date string, seq int, params *TransformerUserParams) string {
+	b := strings.Builder{}
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+			continue
+		}
+		value := ""
+		switch part {
+		case "name":
+			value = strings.TrimSuffix(inputName, filepath.Ext(inputName))
+		case "date":
+			value = date
+		case "seq":
+			value = strconv.Itoa(seq)
+		default:
+			field, _ := paramField(part)
+			value = formatParam(reflect.ValueOf(params).Elem().FieldByName(field))
+		}
+		// values such as mask paths must not turn into directories
+		b.WriteString(strings.NewReplacer("/", "-", `\`, "-").Replace(value))
+	}
+	return b.String() + "." + params.OutputFileType
+}
+
+// paramField finds the param for a placeholder, which is the flag name with or without dashes
+func paramField(placeholder string) (string, bool) {
+	if field, ok := paramAliases[placeholder]; ok {
+		return field, true
+	}
+	normalized := strings.ReplaceAll(placeholder, "-", "")
+	paramsType := reflect.TypeOf(TransformerUserParams{})
+	for i := 0; i < paramsType.NumField(); i++ {
+		if strings.EqualFold(paramsType.Field(i).Name, normalized) {
+			return paramsType.Field(i).Name, true
+		}
+	}
+	return "", false
+}
+
+// formatParam writes a param the way it would be passed as a flag
+func formatParam(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Slice:
+		values := []string{}
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, fmt.Sprint(v.Index(i).Interface()))
+		}
+		return strings.Join(values, "+")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// validateOnExists checks the policy for outputs that already exist
+func validateOnExists(policy string) error {
+	switch policy {
+	case "", OnExistsIncrement, OnExistsOverwrite, OnExistsSkip:
+		return nil
+	}
+	return fmt.Errorf("invalid on-exists %s; it must be %s, %s, or %s", policy, OnExistsIncrement, OnExistsOverwrite, OnExistsSkip)
+}
+
+// claimOutput applies the on-exists policy to an output, returning the name to use, or false if the input
+// should be skipped. Names already given to other inputs in the run count as taken under every policy, so
+// parallel jobs and inputs with the same name never write over each other; overwrite and skip only apply to
+// files from earlier runs
+func claimOutput(dir, name, policy string, claimed map[string]bool) (string, bool) {
+	taken := func(name string) bool {
+		path := filepath.Join(dir, name)
+		if claimed[path] {
+			return true
+		}
+		if policy == OnExistsOverwrite {
+			return false
+		}
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	switch {
+	case !taken(name):
+	case policy == OnExistsSkip && !claimed[filepath.Join(dir, name)]:
+		return name, false
+	default:
+		extension := filepath.Ext(name)
+		base := strings.TrimSuffix(name, extension)
+		for i := 2; taken(name); i++ {
+			name = fmt.Sprintf("%s_%d%s", base, i, extension)
+		}
+	}
+	claimed[filepath.Join(dir, name)] = true
+	return name, true
+}
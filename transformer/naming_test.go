@@ -0,0 +1,48 @@
+package transformer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClaimOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		existing []string
+		claimed  []string
+		want     string
+		wantOK   bool
+	}{
+		{name: "free", policy: OnExistsIncrement, want: "a.png", wantOK: true},
+		{name: "increment past files", policy: OnExistsIncrement, existing: []string{"a.png", "a_2.png"}, want: "a_3.png", wantOK: true},
+		{name: "increment past claims", policy: OnExistsIncrement, claimed: []string{"a.png"}, want: "a_2.png", wantOK: true},
+		{name: "overwrite a file", policy: OnExistsOverwrite, existing: []string{"a.png"}, want: "a.png", wantOK: true},
+		{name: "overwrite does not replace claims", policy: OnExistsOverwrite, claimed: []string{"a.png", "a_2.png"}, want: "a_3.png", wantOK: true},
+		{name: "overwrite a file after a claim", policy: OnExistsOverwrite, existing: []string{"a_2.png"}, claimed: []string{"a.png"}, want: "a_2.png", wantOK: true},
+		{name: "skip a file", policy: OnExistsSkip, existing: []string{"a.png"}, want: "a.png", wantOK: false},
+		{name: "skip increments past claims", policy: OnExistsSkip, claimed: []string{"a.png"}, want: "a_2.png", wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			claimed := map[string]bool{}
+			for _, name := range tt.claimed {
+				claimed[filepath.Join(dir, name)] = true
+			}
+			got, ok := claimOutput(dir, "a.png", tt.policy, claimed)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("claimOutput() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOK)
+			}
+			if ok && !claimed[filepath.Join(dir, got)] {
+				t.Errorf("claimOutput() did not claim %s", got)
+			}
+		})
+	}
+}
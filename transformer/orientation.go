@@ -0,0 +1,180 @@
+package transformer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/kevineaton/art/canvas"
+)
+
+const (
+	// OrientationRandom rotates each shape randomly, the original behavior of the transformer
+	OrientationRandom = "random"
+	// OrientationGradient rotates each shape to follow the edge running through its location
+	OrientationGradient = "gradient"
+	// OrientationStructure rotates each shape to follow the smoothed structure tensor of the source, which
+	// gives longer and calmer flows than the gradient
+	OrientationStructure = "structure"
+)
+
+// orientations is used to validate the orientation flag
+var orientations = []string{OrientationRandom, OrientationGradient, OrientationStructure}
+
+// orientationFloor is the strength below which an area is considered flat and keeps its random rotation
+const orientationFloor = 0.02
+
+// structureRadius is the radius of the box blur applied to the structure tensor, in importance map cells
+const structureRadius = 4
+
+// validateOrientation makes sure the orientation is one we know about and the elongation makes sense
+func validateOrientation(params *TransformerUserParams) error {
+	known := false
+	for _, orientation := range orientations {
+		if params.Orientation == orientation {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("invalid orientation %s; valid orientations are %s", params.Orientation, strings.Join(orientations, ", "))
+	}
+	if params.Elongation <= 0 {
+		return fmt.Errorf("invalid elongation %v; it must be greater than 0", params.Elongation)
+	}
+	return nil
+}
+
+// orientationField holds the direction of the contours across the source along with how strong they are
+type orientationField struct {
+	cols, rows     int
+	scaleX, scaleY float64
+	angles         []float64
+	strengths      []float64
+}
+
+// newOrientationField computes the field for the source; it returns nil for random orientation
+func newOrientationField(source image.Image, orientation string) *orientationField {
+	if orientation != OrientationGradient && orientation != OrientationStructure {
+		return nil
+	}
+	gray, cols, rows := grayscaleGrid(source)
+	gx, gy := sobelGradient(gray, cols, rows)
+	bounds := source.Bounds()
+	f := &orientationField{
+		cols:      cols,
+		rows:      rows,
+		scaleX:    float64(cols) / float64(bounds.Dx()),
+		scaleY:    float64(rows) / float64(bounds.Dy()),
+		angles:    make([]float64, len(gray)),
+		strengths: make([]float64, len(gray)),
+	}
+
+	if orientation == OrientationGradient {
+		for i := range gray {
+			// contours run across the gradient
+			f.angles[i] = math.Atan2(gy[i], gx[i]) + math.Pi/2
+			f.strengths[i] = math.Hypot(gx[i], gy[i])
+		}
+	} else {
+		// the tensor is averaged rather than the gradient, since opposite gradients on either side of a line
+		// would otherwise cancel out
+		jxx, jxy, jyy := make([]float64, len(gray)), make([]float64, len(gray)), make([]float64, len(gray))
+		for i := range gray {
+			jxx[i], jxy[i], jyy[i] = gx[i]*gx[i], gx[i]*gy[i], gy[i]*gy[i]
+		}
+		jxx, jxy, jyy = boxBlur(jxx, cols, rows, structureRadius), boxBlur(jxy, cols, rows, structureRadius), boxBlur(jyy, cols, rows, structureRadius)
+		for i := range gray {
+			f.angles[i] = 0.5*math.Atan2(2*jxy[i], jxx[i]-jyy[i]) + math.Pi/2
+			f.strengths[i] = math.Sqrt(jxx[i] + jyy[i])
+		}
+	}
+
+	highest := 0.0
+	for _, strength := range f.strengths {
+		highest = math.Max(highest, strength)
+	}
+	if highest > 0 {
+		for i := range f.strengths {
+			f.strengths[i] /= highest
+		}
+	}
+	return f
+}
+
+// at returns the direction of the contour at a location in source pixels; false means the area is flat
+func (f *orientationField) at(x, y float64) (float64, bool) {
+	col := max(0, min(int(x*f.scaleX), f.cols-1))
+	row := max(0, min(int(y*f.scaleY), f.rows-1))
+	i := row*f.cols + col
+	if f.strengths[i] < orientationFloor {
+		return 0, false
+	}
+	return f.angles[i], true
+}
+
+// boxBlur averages each cell with its neighbors within the radius, running once along each axis
+func boxBlur(values []float64, cols, rows, radius int) []float64 {
+	blur := func(in []float64, length, count int, index func(line, i int) int) []float64 {
+		out := make([]float64, len(in))
+		for line := 0; line < count; line++ {
+			for i := 0; i < length; i++ {
+				sum, n := 0.0, 0.0
+				for j := max(0, i-radius); j <= min(length-1, i+radius); j++ {
+					sum += in[index(line, j)]
+					n++
+				}
+				out[index(line, i)] = sum / n
+			}
+		}
+		return out
+	}
+	values = blur(values, cols, rows, func(line, i int) int { return line*cols + i })
+	return blur(values, rows, cols, func(line, i int) int { return i*cols + line })
+}
+
+// Stretched elongates another shape along a direction while keeping its area, so round and blocky shapes
+// become brush strokes
+type Stretched struct {
+	Shape
+	X, Y    float64
+	Angle   float64
+	Stretch float64
+}
+
+// stretch wraps the shape if the elongation changes it
+func stretch(shape Shape, x, y, angle, elongation float64) Shape {
+	if elongation == 1 {
+		return shape
+	}
+	return &Stretched{Shape: shape, X: x, Y: y, Angle: angle, Stretch: elongation}
+}
+
+func (s *Stretched) Path(dc canvas.Canvas) {
+	dc.Push()
+	dc.RotateAbout(s.Angle, s.X, s.Y)
+	dc.ScaleAbout(math.Sqrt(s.Stretch), 1/math.Sqrt(s.Stretch), s.X, s.Y)
+	dc.RotateAbout(-s.Angle, s.X, s.Y)
+	s.Shape.Path(dc)
+	dc.Pop()
+}
+
+func (s *Stretched) Bounds() image.Rectangle {
+	inner := s.Shape.Bounds()
+	along, across := math.Sqrt(s.Stretch), 1/math.Sqrt(s.Stretch)
+	sin, cos := math.Sincos(s.Angle)
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, corner := range []image.Point{inner.Min, {inner.Max.X, inner.Min.Y}, {inner.Min.X, inner.Max.Y}, inner.Max} {
+		// move into the frame of the stretch, scale, and move back
+		dx, dy := float64(corner.X)-s.X, float64(corner.Y)-s.Y
+		u, v := (dx*cos+dy*sin)*along, (-dx*sin+dy*cos)*across
+		x, y := s.X+u*cos-v*sin, s.Y+u*sin+v*cos
+		minX, minY, maxX, maxY = math.Min(minX, x), math.Min(minY, y), math.Max(maxX, x), math.Max(maxY, y)
+	}
+	return image.Rect(int(minX)-2, int(minY)-2, int(maxX)+3, int(maxY)+3)
+}
+
+func (s *Stretched) Mutate(rng *rand.Rand, amount float64) Shape {
+	return &Stretched{Shape: s.Shape.Mutate(rng, amount), X: s.X, Y: s.Y, Angle: s.Angle, Stretch: s.Stretch}
+}
@@ -0,0 +1,206 @@
+package transformer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/kevineaton/art/canvas"
+	"github.com/kevineaton/art/imageutils"
+	"github.com/spf13/cobra"
+)
+
+// RenderParams are the options for replaying a shape log
+type RenderParams struct {
+	Width          int
+	Height         int
+	Scale          float64
+	Background     string
+	Source         string
+	Output         string
+	OutputFileType string
+	OutputOptions  string
+}
+
+// GetRenderCommand returns the command that replays a shape log written by transform
+func GetRenderCommand() *cobra.Command {
+	params := &RenderParams{}
+	cmd := &cobra.Command{
+		Use:   "render <shape log>",
+		Short: "Replay a shape log from transform onto a canvas of any size",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := Render(args[0], params); err != nil {
+				return commandError(cmd, os.Stdout, err)
+			}
+			fmt.Printf("Done!\n")
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&params.Width, "width", 0, "Width of the render; if only the width or height is set, the other keeps the aspect ratio of the log")
+	cmd.Flags().IntVar(&params.Height, "height", 0, "Height of the render; if only the width or height is set, the other keeps the aspect ratio of the log")
+	cmd.Flags().Float64Var(&params.Scale, "scale", 1, "Multiply the size of the log by this amount when neither width nor height is set")
+	cmd.Flags().StringVar(&params.Background, "background", "", "Replace the background from the log; a hex color, transparent (png, tiff, or svg only), source, blur, desaturate, or average")
+	cmd.Flags().StringVar(&params.Source, "source", "", "The source image to use for backgrounds that need it, if it has moved since the log was written")
+	cmd.Flags().StringVar(&params.Output, "output", "", "Where to save the render; defaults to the name of the log with the size added, in ./output")
+	cmd.Flags().StringVar(&params.OutputFileType, "output-type", "png", "The desired output, either png, jpg, gif, bmp, tiff, or svg")
+	cmd.Flags().StringVar(&params.OutputOptions, "output-options", "", outputOptionsHelp)
+	return cmd
+}
+
+// Render replays a shape log onto a new canvas and saves it
+func Render(logPath string, params *RenderParams) error {
+	format, err := imageutils.GetImageFormatFromString(params.OutputFileType)
+	if err != nil {
+		return fmt.Errorf("invalid output type %s; use png, jpg, gif, bmp, tiff, or svg", params.OutputFileType)
+	}
+	encoding, err := imageutils.ParseEncodeOptions(params.OutputOptions)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(logPath)
+	if err != nil {
+		return fmt.Errorf("could not open the shape log: %w", err)
+	}
+	defer f.Close()
+
+	var dc *gg.Context
+	var vector *canvas.SVG
+	var drawing canvas.Canvas
+	var lineScale float64
+	shapes := 0
+	start := func(header shapeLogHeader) error {
+		scaleX, scaleY := renderScale(header, params)
+		width, height := max(1, int(math.Round(float64(header.Width)*scaleX))), max(1, int(math.Round(float64(header.Height)*scaleY)))
+		lineScale = (scaleX + scaleY) / 2
+
+		background := header.Background
+		if params.Background != "" {
+			background = params.Background
+		}
+		if err := validateBackground(background, format); err != nil {
+			return err
+		}
+		source, err := renderSource(header, params, background)
+		if err != nil {
+			return err
+		}
+
+		dc = gg.NewContext(width, height)
+		paintBackground(dc, source, background)
+		drawing = dc
+		if format == imageutils.ImageFormatSVG {
+			vector = canvas.NewSVG(width, height)
+			paintVectorBackground(vector, dc, source, background)
+			drawing = canvas.Tee(dc, vector)
+		}
+		if len(header.Mask) > 0 {
+			clip, err := renderClip(header.Mask, width, height)
+			if err != nil {
+				return err
+			}
+			dc.SetMask(clip)
+			if vector != nil {
+				if err := vector.SetMask(clip); err != nil {
+					return err
+				}
+			}
+		}
+		drawing.Push()
+		drawing.ScaleAbout(scaleX, scaleY, 0, 0)
+		return nil
+	}
+	draw := func(shape Shape, fill, outline color.NRGBA) {
+		paintShape(drawing, shape, fill, outline, lineScale)
+		shapes++
+	}
+	if err := readShapeLog(f, start, draw); err != nil {
+		return err
+	}
+	drawing.Pop()
+
+	output := params.Output
+	if output == "" {
+		base := strings.TrimSuffix(filepath.Base(logPath), shapeLogExtension)
+		output = fmt.Sprintf("./output/%s_%dx%d.%s", base, dc.Width(), dc.Height(), format)
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("could not create the output directory: %w", err)
+	}
+	if vector != nil {
+		err = vector.Save(output)
+	} else {
+		err = imageutils.SaveImage(dc.Image(), format, output, imageutils.Metadata{
+			MetadataSoftware: "art " + toolVersion(),
+			MetadataVersion:  toolVersion(),
+			MetadataCommand:  commandLine(),
+			MetadataShapeLog: logPath,
+		}, encoding)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rendered %d shapes at %dx%d to %s\n", shapes, dc.Width(), dc.Height(), output)
+	return nil
+}
+
+// renderClip stretches the mask from a shape log over the rendered canvas
+func renderClip(encoded []byte, width, height int) (*image.Alpha, error) {
+	img, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the mask in the shape log: %w", err)
+	}
+	gray := image.NewGray(img.Bounds())
+	draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+	return clipMask(gray, width, height), nil
+}
+
+// renderScale works out how much to scale each axis of the log
+func renderScale(header shapeLogHeader, params *RenderParams) (float64, float64) {
+	scaleX, scaleY := params.Scale, params.Scale
+	if scaleX <= 0 {
+		scaleX, scaleY = 1, 1
+	}
+	if params.Width > 0 {
+		scaleX = float64(params.Width) / float64(header.Width)
+	}
+	if params.Height > 0 {
+		scaleY = float64(params.Height) / float64(header.Height)
+	}
+	switch {
+	case params.Width > 0 && params.Height <= 0:
+		scaleY = scaleX
+	case params.Height > 0 && params.Width <= 0:
+		scaleX = scaleY
+	}
+	return scaleX, scaleY
+}
+
+// renderSource loads the region of the source the log was drawn from, if the background needs it
+func renderSource(header shapeLogHeader, params *RenderParams, background string) (image.Image, error) {
+	switch strings.ToLower(background) {
+	case BackgroundSource, BackgroundBlur, BackgroundDesaturate, BackgroundAverage:
+	default:
+		return nil, nil
+	}
+	path := header.Source
+	if params.Source != "" {
+		path = params.Source
+	}
+	source, err := imageutils.LoadImage(path)
+	if err != nil {
+		return nil, fmt.Errorf("the %s background needs the source image; pass it with --source or choose another background: %w", background, err)
+	}
+	if header.Crop.Empty() || !header.Crop.In(source.Bounds()) {
+		return source, nil
+	}
+	return cropImage(source, header.Crop), nil
+}
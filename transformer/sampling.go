@@ -0,0 +1,320 @@
+package transformer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+const (
+	// SamplingUniform picks every location with equal probability
+	SamplingUniform = "uniform"
+	// SamplingEdge favors locations with strong edges in the source
+	SamplingEdge = "edge"
+	// SamplingVariance favors locations with a lot of local contrast in the source
+	SamplingVariance = "variance"
+	// SamplingGrid visits every cell of a grid in a random order before visiting any cell again
+	SamplingGrid = "grid"
+	// SamplingPoisson spreads locations out so they are never closer than the current stroke size
+	SamplingPoisson = "poisson"
+)
+
+// samplingStrategies is used to validate the sampling flag
+var samplingStrategies = []string{SamplingUniform, SamplingEdge, SamplingVariance, SamplingGrid, SamplingPoisson}
+
+// importanceMapSize is the longest side of the importance map; larger sources are sampled down to it
+const importanceMapSize = 512
+
+// importanceFloor is added to every cell of an importance map so flat areas are still painted occasionally
+const importanceFloor = 0.02
+
+// sampler picks the location on the source for the next shape
+type sampler interface {
+	// next returns a location in source pixels; radius is the current stroke size in source pixels
+	next(rng *rand.Rand, radius float64) (float64, float64)
+}
+
+// validateSampling makes sure the strategy is one we know about
+func validateSampling(strategy string) error {
+	for _, known := range samplingStrategies {
+		if strategy == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid sampling %s; valid strategies are %s", strategy, strings.Join(samplingStrategies, ", "))
+}
+
+// newSampler creates the sampler for the strategy; if there is a mask, it steers where the sampler goes
+func newSampler(strategy string, source image.Image, totalCycles int, mask *weightMap) sampler {
+	bounds := source.Bounds()
+	width, height := float64(bounds.Max.X), float64(bounds.Max.Y)
+	switch strategy {
+	case SamplingEdge:
+		return newImportanceMap(source, sobelMagnitude, mask)
+	case SamplingVariance:
+		return newImportanceMap(source, localVariance, mask)
+	case SamplingGrid:
+		return withMask(newGridSampler(width, height, totalCycles), mask)
+	case SamplingPoisson:
+		return withMask(newPoissonSampler(width, height), mask)
+	}
+	if mask != nil {
+		return newImportanceMap(source, nil, mask)
+	}
+	return &uniformSampler{width: width, height: height}
+}
+
+// withMask wraps a sampler so it follows the mask, if there is one
+func withMask(inner sampler, mask *weightMap) sampler {
+	if mask == nil {
+		return inner
+	}
+	return &maskedSampler{inner: inner, mask: mask}
+}
+
+// uniformSampler is the original behavior of the transformer
+type uniformSampler struct {
+	width, height float64
+}
+
+func (u *uniformSampler) next(rng *rand.Rand, radius float64) (float64, float64) {
+	x := rng.Float64() * u.width
+	y := rng.Float64() * u.height
+	return x, y
+}
+
+// importanceMap samples cells of a grid over the source in proportion to their weight
+type importanceMap struct {
+	cols, rows   int
+	cellW, cellH float64
+	cdf          []float64
+}
+
+// newImportanceMap builds the map from a measure computed over a grayscale copy of the source. A nil measure
+// weights every cell the same, and the mask, if there is one, scales the weight of each cell
+func newImportanceMap(source image.Image, measure func(gray []float64, cols, rows int) []float64, mask *weightMap) *importanceMap {
+	gray, cols, rows := grayscaleGrid(source)
+	weights := make([]float64, len(gray))
+	if measure != nil {
+		weights = measure(gray, cols, rows)
+	}
+	bounds := source.Bounds()
+	m := &importanceMap{
+		cols:  cols,
+		rows:  rows,
+		cellW: float64(bounds.Max.X) / float64(cols),
+		cellH: float64(bounds.Max.Y) / float64(rows),
+		cdf:   make([]float64, len(weights)),
+	}
+
+	// normalize so the floor means the same thing regardless of the measure
+	highest := 0.0
+	for _, w := range weights {
+		highest = math.Max(highest, w)
+	}
+	if highest == 0 {
+		highest = 1
+	}
+	total := 0.0
+	for i, w := range weights {
+		w = w/highest + importanceFloor
+		if mask != nil {
+			w *= mask.at((float64(i%cols)+0.5)*m.cellW, (float64(i/cols)+0.5)*m.cellH)
+		}
+		total += w
+		m.cdf[i] = total
+	}
+	return m
+}
+
+func (m *importanceMap) next(rng *rand.Rand, radius float64) (float64, float64) {
+	// a mask that is black everywhere leaves nothing to sample, which the caller handles by skipping the cycle
+	if m.cdf[len(m.cdf)-1] == 0 {
+		return rng.Float64() * m.cellW * float64(m.cols), rng.Float64() * m.cellH * float64(m.rows)
+	}
+	target := rng.Float64() * m.cdf[len(m.cdf)-1]
+	cell := sort.SearchFloat64s(m.cdf, target)
+	if cell >= len(m.cdf) {
+		cell = len(m.cdf) - 1
+	}
+	x := (float64(cell%m.cols) + rng.Float64()) * m.cellW
+	y := (float64(cell/m.cols) + rng.Float64()) * m.cellH
+	return x, y
+}
+
+// grayscaleGrid samples the luminance of the source onto a grid no larger than importanceMapSize
+func grayscaleGrid(source image.Image) ([]float64, int, int) {
+	bounds := source.Bounds()
+	scale := math.Max(float64(bounds.Dx()), float64(bounds.Dy())) / importanceMapSize
+	if scale < 1 {
+		scale = 1
+	}
+	cols := max(1, int(float64(bounds.Dx())/scale))
+	rows := max(1, int(float64(bounds.Dy())/scale))
+	gray := make([]float64, cols*rows)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			r, g, b := rgb255(source.At(bounds.Min.X+int(float64(x)*scale), bounds.Min.Y+int(float64(y)*scale)))
+			gray[y*cols+x] = 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+		}
+	}
+	return gray, cols, rows
+}
+
+// sobelMagnitude returns the gradient magnitude of each cell using the Sobel operator
+func sobelMagnitude(gray []float64, cols, rows int) []float64 {
+	gx, gy := sobelGradient(gray, cols, rows)
+	out := make([]float64, len(gray))
+	for i := range out {
+		out[i] = math.Hypot(gx[i], gy[i])
+	}
+	return out
+}
+
+// sobelGradient returns the horizontal and vertical gradient of each cell using the Sobel operator
+func sobelGradient(gray []float64, cols, rows int) ([]float64, []float64) {
+	at := func(x, y int) float64 {
+		x = max(0, min(x, cols-1))
+		y = max(0, min(y, rows-1))
+		return gray[y*cols+x]
+	}
+	gx, gy := make([]float64, len(gray)), make([]float64, len(gray))
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			gx[y*cols+x] = at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy[y*cols+x] = at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+		}
+	}
+	return gx, gy
+}
+
+// localVariance returns the variance of the 5x5 neighborhood around each cell
+func localVariance(gray []float64, cols, rows int) []float64 {
+	const radius = 2
+	out := make([]float64, len(gray))
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			sum, sumSq, n := 0.0, 0.0, 0.0
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= cols || ny >= rows {
+						continue
+					}
+					v := gray[ny*cols+nx]
+					sum += v
+					sumSq += v * v
+					n++
+				}
+			}
+			mean := sum / n
+			out[y*cols+x] = sumSq/n - mean*mean
+		}
+	}
+	return out
+}
+
+// gridSampler is stratified sampling; each pass visits every cell once in a random order
+type gridSampler struct {
+	cols, rows   int
+	cellW, cellH float64
+	order        []int
+}
+
+// newGridSampler sizes the grid so a run covers it a few times, keeping the cells roughly square
+func newGridSampler(width, height float64, totalCycles int) *gridSampler {
+	cells := math.Max(1, math.Min(float64(totalCycles)/4, 4096))
+	cols := max(1, int(math.Round(math.Sqrt(cells*width/height))))
+	rows := max(1, int(math.Round(cells/float64(cols))))
+	return &gridSampler{
+		cols:  cols,
+		rows:  rows,
+		cellW: width / float64(cols),
+		cellH: height / float64(rows),
+	}
+}
+
+func (g *gridSampler) next(rng *rand.Rand, radius float64) (float64, float64) {
+	if len(g.order) == 0 {
+		g.order = rng.Perm(g.cols * g.rows)
+	}
+	cell := g.order[len(g.order)-1]
+	g.order = g.order[:len(g.order)-1]
+	x := (float64(cell%g.cols) + rng.Float64()) * g.cellW
+	y := (float64(cell/g.cols) + rng.Float64()) * g.cellH
+	return x, y
+}
+
+// poissonAttempts is how many candidates are tried before the current layer is considered full
+const poissonAttempts = 30
+
+// poissonSampler throws darts that must land at least the current radius away from the other points in
+// the layer. Once a layer is full, a new one is started on top of it, which keeps the blue noise
+// distribution as the strokes shrink
+type poissonSampler struct {
+	width, height float64
+	cellSize      float64
+	cols, rows    int
+	grid          map[int][]poissonPoint
+}
+
+type poissonPoint struct {
+	x, y float64
+}
+
+func newPoissonSampler(width, height float64) *poissonSampler {
+	return &poissonSampler{width: width, height: height}
+}
+
+func (p *poissonSampler) next(rng *rand.Rand, radius float64) (float64, float64) {
+	radius = math.Max(radius, 1)
+	if p.grid == nil || radius > p.cellSize*2 {
+		p.newLayer(radius)
+	}
+	for attempt := 0; attempt < poissonAttempts; attempt++ {
+		x, y := rng.Float64()*p.width, rng.Float64()*p.height
+		if p.fits(x, y, radius) {
+			p.add(x, y)
+			return x, y
+		}
+	}
+
+	// the layer is full, so start a new one at the current radius
+	p.newLayer(radius)
+	x, y := rng.Float64()*p.width, rng.Float64()*p.height
+	p.add(x, y)
+	return x, y
+}
+
+func (p *poissonSampler) newLayer(radius float64) {
+	p.cellSize = radius / 2
+	p.cols = int(p.width/p.cellSize) + 1
+	p.rows = int(p.height/p.cellSize) + 1
+	p.grid = map[int][]poissonPoint{}
+}
+
+func (p *poissonSampler) fits(x, y, radius float64) bool {
+	cx, cy := int(x/p.cellSize), int(y/p.cellSize)
+	reach := int(math.Ceil(radius / p.cellSize))
+	for gy := cy - reach; gy <= cy+reach; gy++ {
+		for gx := cx - reach; gx <= cx+reach; gx++ {
+			if gx < 0 || gy < 0 || gx >= p.cols || gy >= p.rows {
+				continue
+			}
+			for _, other := range p.grid[gy*p.cols+gx] {
+				if math.Hypot(other.x-x, other.y-y) < radius {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func (p *poissonSampler) add(x, y float64) {
+	cell := int(y/p.cellSize)*p.cols + int(x/p.cellSize)
+	p.grid[cell] = append(p.grid[cell], poissonPoint{x: x, y: y})
+}
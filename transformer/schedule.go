@@ -0,0 +1,136 @@
+package transformer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ScheduleLinear moves evenly between each value
+	ScheduleLinear = "linear"
+	// ScheduleExponential moves by the same ratio on every step, like the original stroke reduction
+	ScheduleExponential = "exp"
+	// ScheduleCosine eases in and out of each value
+	ScheduleCosine = "cosine"
+	// ScheduleStep holds each value for an equal share of the run
+	ScheduleStep = "step"
+	// ScheduleKeyframes moves linearly between values pinned to points in the run, such as 0=1,0.5=0.2,1=0.05
+	ScheduleKeyframes = "keyframes"
+)
+
+// schedule maps the progress of a run, from 0 to 1, to a value
+type schedule struct {
+	kind   string
+	keys   []float64
+	values []float64
+}
+
+// parseSchedule parses a schedule such as linear:1,0.05 or keyframes:0=1,0.8=0.1,1=0.02. An empty string
+// returns nil, which means the per cycle flags are used instead
+func parseSchedule(spec string) (*schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	kind, list, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid schedule %s; expected a kind and values such as linear:1,0.05", spec)
+	}
+	s := &schedule{kind: strings.ToLower(strings.TrimSpace(kind))}
+	switch s.kind {
+	case ScheduleLinear, ScheduleExponential, ScheduleCosine, ScheduleStep, ScheduleKeyframes:
+	default:
+		return nil, fmt.Errorf("invalid schedule kind %s; valid kinds are %s", s.kind, strings.Join([]string{ScheduleLinear, ScheduleExponential, ScheduleCosine, ScheduleStep, ScheduleKeyframes}, ", "))
+	}
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key := -1.0
+		if s.kind == ScheduleKeyframes {
+			keyString, valueString, ok := strings.Cut(entry, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid keyframe %s; expected progress=value", entry)
+			}
+			k, err := strconv.ParseFloat(strings.TrimSpace(keyString), 64)
+			if err != nil || k < 0 || k > 1 {
+				return nil, fmt.Errorf("invalid keyframe progress %s; it must be between 0 and 1", keyString)
+			}
+			key, entry = k, valueString
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(entry), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule value %s", entry)
+		}
+		if s.kind == ScheduleExponential && value <= 0 {
+			return nil, errors.New("exponential schedules require values greater than 0")
+		}
+		s.keys = append(s.keys, key)
+		s.values = append(s.values, value)
+	}
+	if len(s.values) == 0 {
+		return nil, fmt.Errorf("the schedule %s has no values", spec)
+	}
+
+	if s.kind == ScheduleKeyframes {
+		order := make([]int, len(s.keys))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return s.keys[order[a]] < s.keys[order[b]]
+		})
+		keys, values := make([]float64, len(order)), make([]float64, len(order))
+		for i, o := range order {
+			keys[i], values[i] = s.keys[o], s.values[o]
+		}
+		s.keys, s.values = keys, values
+	} else {
+		// spread the values evenly over the run
+		for i := range s.keys {
+			if len(s.keys) == 1 {
+				s.keys[i] = 0
+			} else {
+				s.keys[i] = float64(i) / float64(len(s.keys)-1)
+			}
+		}
+	}
+	return s, nil
+}
+
+// at returns the value of the schedule at the given progress
+func (s *schedule) at(progress float64) float64 {
+	progress = math.Max(0, math.Min(1, progress))
+	if s.kind == ScheduleStep {
+		index := int(progress * float64(len(s.values)))
+		return s.values[min(index, len(s.values)-1)]
+	}
+	if progress <= s.keys[0] {
+		return s.values[0]
+	}
+	for i := 1; i < len(s.keys); i++ {
+		if progress > s.keys[i] {
+			continue
+		}
+		span := s.keys[i] - s.keys[i-1]
+		if span <= 0 {
+			return s.values[i]
+		}
+		t := (progress - s.keys[i-1]) / span
+		from, to := s.values[i-1], s.values[i]
+		switch s.kind {
+		case ScheduleExponential:
+			return from * math.Pow(to/from, t)
+		case ScheduleCosine:
+			t = (1 - math.Cos(t*math.Pi)) / 2
+		}
+		return from + (to-from)*t
+	}
+	return s.values[len(s.values)-1]
+}
@@ -0,0 +1,56 @@
+package transformer
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		at      map[float64]float64
+		wantErr string
+	}{
+		{spec: "linear:1,0.05", at: map[float64]float64{0: 1, 0.5: 0.525, 1: 0.05}},
+		{spec: "linear:2", at: map[float64]float64{0: 2, 0.7: 2, 1: 2}},
+		{spec: "exp:1,0.01", at: map[float64]float64{0: 1, 0.5: 0.1, 1: 0.01}},
+		{spec: "cosine:20,220", at: map[float64]float64{0: 20, 0.5: 120, 1: 220}},
+		{spec: "step:1,0.5,0.25", at: map[float64]float64{0: 1, 0.4: 0.5, 0.9: 0.25, 1: 0.25}},
+		{spec: "keyframes:1=0.02,0=1,0.5=0.2", at: map[float64]float64{0: 1, 0.25: 0.6, 0.5: 0.2, 0.75: 0.11, 1: 0.02}},
+		{spec: " LINEAR: 1 , 3 ", at: map[float64]float64{-1: 1, 0.5: 2, 2: 3}},
+		{spec: "", at: nil},
+		{spec: "1,0.05", wantErr: "expected a kind and values"},
+		{spec: "wobble:1,2", wantErr: "invalid schedule kind wobble"},
+		{spec: "linear:", wantErr: "has no values"},
+		{spec: "linear:1,x", wantErr: "invalid schedule value x"},
+		{spec: "exp:1,0", wantErr: "greater than 0"},
+		{spec: "keyframes:0.5", wantErr: "expected progress=value"},
+		{spec: "keyframes:1.5=2", wantErr: "between 0 and 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseSchedule() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSchedule() error = %v", err)
+			}
+			if tt.at == nil {
+				if s != nil {
+					t.Errorf("parseSchedule() = %+v, want nil", s)
+				}
+				return
+			}
+			for progress, want := range tt.at {
+				if got := s.at(progress); math.Abs(got-want) > 1e-9 {
+					t.Errorf("at(%v) = %v, want %v", progress, got, want)
+				}
+			}
+		})
+	}
+}
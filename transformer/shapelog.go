@@ -0,0 +1,222 @@
+package transformer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shapeLogVersion is bumped whenever the log format changes in a way older logs cannot be replayed
+const shapeLogVersion = 1
+
+// shapeLogExtension is added to the output name to get the name of the shape log
+const shapeLogExtension = ".shapes.jsonl"
+
+// shapeLogHeader is the first line of a shape log and describes the canvas the shapes were drawn on
+type shapeLogHeader struct {
+	Version    int             `json:"version"`
+	Width      int             `json:"width"`
+	Height     int             `json:"height"`
+	Background string          `json:"background"`
+	Source     string          `json:"source"`
+	Crop       image.Rectangle `json:"crop"`
+	// Mask is the cropped mask as a png, so a render keeps shapes out of its black areas too
+	Mask []byte `json:"mask,omitempty"`
+}
+
+// shapeLogEntry is a single shape that was drawn, in the order it was drawn
+type shapeLogEntry struct {
+	Kind    string           `json:"kind"`
+	Shape   json.RawMessage  `json:"shape"`
+	Stretch *shapeLogStretch `json:"stretch,omitempty"`
+	Fill    [4]uint8         `json:"fill"`
+	Outline [4]uint8         `json:"outline"`
+}
+
+// shapeLogStretch is the elongation applied to a shape, if any
+type shapeLogStretch struct {
+	X       float64 `json:"x"`
+	Y       float64 `json:"y"`
+	Angle   float64 `json:"angle"`
+	Stretch float64 `json:"stretch"`
+}
+
+// shapeKinds creates an empty shape for each kind that can appear in a log
+var shapeKinds = map[string]func() Shape{
+	"polygon":   func() Shape { return &Polygon{} },
+	"ellipse":   func() Shape { return &Ellipse{} },
+	"rectangle": func() Shape { return &Rectangle{} },
+	"line":      func() Shape { return &Line{} },
+	"blob":      func() Shape { return &Blob{} },
+	"glyph":     func() Shape { return &Glyph{} },
+}
+
+// shapeKind returns the name a shape is logged under
+func shapeKind(shape Shape) (string, error) {
+	switch shape.(type) {
+	case *Polygon:
+		return "polygon", nil
+	case *Ellipse:
+		return "ellipse", nil
+	case *Rectangle:
+		return "rectangle", nil
+	case *Line:
+		return "line", nil
+	case *Blob:
+		return "blob", nil
+	case *Glyph:
+		return "glyph", nil
+	}
+	return "", fmt.Errorf("the shape %T cannot be logged", shape)
+}
+
+// shapeLog writes shapes as JSON lines. Errors are kept and returned by flush so the cycle loop does not
+// have to check every shape
+type shapeLog struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	written int64
+	err     error
+}
+
+// newShapeLog writes a log to w, which already holds offset bytes of the log when a run is resumed
+func newShapeLog(w io.Writer, offset int64) *shapeLog {
+	l := &shapeLog{written: offset}
+	l.writer = bufio.NewWriter(&countingWriter{w: w, n: &l.written})
+	l.encoder = json.NewEncoder(l.writer)
+	return l
+}
+
+// countingWriter keeps a running total of the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// openShapeLog opens the log file for a job next to its output, or reopens the log of the checkpoint it resumes
+// and drops anything written after the point the checkpoint was saved
+func openShapeLog(job transformJob) (*os.File, string, int64, error) {
+	if job.resume != nil && job.resume.ShapeLog != "" {
+		path, offset := job.resume.ShapeLog, job.resume.ShapeLogOffset
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("could not open the shape log: %w", err)
+		}
+		if err := f.Truncate(offset); err != nil {
+			f.Close()
+			return nil, "", 0, fmt.Errorf("could not rewind the shape log: %w", err)
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, "", 0, fmt.Errorf("could not rewind the shape log: %w", err)
+		}
+		return f, path, offset, nil
+	}
+	path := filepath.Join(job.outputDir, strings.TrimSuffix(job.outputName, filepath.Ext(job.outputName))+shapeLogExtension)
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("could not create the shape log: %w", err)
+	}
+	return f, path, 0, nil
+}
+
+// writeHeader starts a new log
+func (l *shapeLog) writeHeader(header shapeLogHeader) error {
+	header.Version = shapeLogVersion
+	if err := l.encoder.Encode(header); err != nil {
+		return fmt.Errorf("could not write the shape log: %w", err)
+	}
+	return nil
+}
+
+// add writes a shape along with the colors it was painted with
+func (l *shapeLog) add(shape Shape, fill, outline color.NRGBA) {
+	if l.err != nil {
+		return
+	}
+	entry := shapeLogEntry{
+		Fill:    [4]uint8{fill.R, fill.G, fill.B, fill.A},
+		Outline: [4]uint8{outline.R, outline.G, outline.B, outline.A},
+	}
+	if stretched, ok := shape.(*Stretched); ok {
+		entry.Stretch = &shapeLogStretch{X: stretched.X, Y: stretched.Y, Angle: stretched.Angle, Stretch: stretched.Stretch}
+		shape = stretched.Shape
+	}
+	if entry.Kind, l.err = shapeKind(shape); l.err != nil {
+		return
+	}
+	if entry.Shape, l.err = json.Marshal(shape); l.err != nil {
+		return
+	}
+	l.err = l.encoder.Encode(entry)
+}
+
+// offset flushes the log and returns its length, which is saved in checkpoints
+func (l *shapeLog) offset() (int64, error) {
+	if err := l.flush(); err != nil {
+		return 0, err
+	}
+	return l.written, nil
+}
+
+// flush writes anything buffered and reports the first error seen while writing the log
+func (l *shapeLog) flush() error {
+	if l.err == nil {
+		l.err = l.writer.Flush()
+	}
+	if l.err != nil {
+		return fmt.Errorf("could not write the shape log: %w", l.err)
+	}
+	return nil
+}
+
+// readShapeLog reads the header of a log and calls draw for each shape in order
+func readShapeLog(r io.Reader, start func(header shapeLogHeader) error, draw func(shape Shape, fill, outline color.NRGBA)) error {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	header := shapeLogHeader{}
+	if err := decoder.Decode(&header); err != nil {
+		return fmt.Errorf("could not read the shape log header: %w", err)
+	}
+	if header.Version != shapeLogVersion {
+		return fmt.Errorf("the shape log is version %d but only version %d is supported", header.Version, shapeLogVersion)
+	}
+	if header.Width <= 0 || header.Height <= 0 {
+		return fmt.Errorf("the shape log header has an invalid canvas size of %dx%d", header.Width, header.Height)
+	}
+	if err := start(header); err != nil {
+		return err
+	}
+	for line := 2; decoder.More(); line++ {
+		entry := shapeLogEntry{}
+		if err := decoder.Decode(&entry); err != nil {
+			return fmt.Errorf("could not read line %d of the shape log: %w", line, err)
+		}
+		create, ok := shapeKinds[entry.Kind]
+		if !ok {
+			return fmt.Errorf("unknown shape %s on line %d of the log", entry.Kind, line)
+		}
+		shape := create()
+		if err := json.Unmarshal(entry.Shape, shape); err != nil {
+			return fmt.Errorf("could not read the %s on line %d of the log: %w", entry.Kind, line, err)
+		}
+		if entry.Stretch != nil {
+			shape = &Stretched{Shape: shape, X: entry.Stretch.X, Y: entry.Stretch.Y, Angle: entry.Stretch.Angle, Stretch: entry.Stretch.Stretch}
+		}
+		fill := color.NRGBA{R: entry.Fill[0], G: entry.Fill[1], B: entry.Fill[2], A: entry.Fill[3]}
+		outline := color.NRGBA{R: entry.Outline[0], G: entry.Outline[1], B: entry.Outline[2], A: entry.Outline[3]}
+		draw(shape, fill, outline)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package transformer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShapeLogRoundTrip(t *testing.T) {
+	header := shapeLogHeader{Width: 120, Height: 80, Background: "#102030", Source: "input/a.png", Crop: image.Rect(0, 0, 60, 40)}
+	shapes := []Shape{
+		&Polygon{X: 10, Y: 20, Radius: 5, Rotation: 1.5, Edges: 6},
+		&Ellipse{X: 30, Y: 40, RadiusX: 8, RadiusY: 3, Rotation: 0.25},
+		&Stretched{Shape: &Rectangle{X: 50, Y: 60, Width: 4, Height: 2}, X: 50, Y: 60, Angle: 0.5, Stretch: 2},
+	}
+	fills := []color.NRGBA{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}}
+	outlines := []color.NRGBA{{1, 2, 3, 4}, {255, 255, 255, 8}, {0, 0, 0, 24}}
+
+	out := &bytes.Buffer{}
+	log := newShapeLog(out, 0)
+	if err := log.writeHeader(header); err != nil {
+		t.Fatalf("writeHeader() error = %v", err)
+	}
+	for i, shape := range shapes {
+		log.add(shape, fills[i], outlines[i])
+	}
+	if err := log.flush(); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+
+	var readHeader shapeLogHeader
+	readShapes := []Shape{}
+	readFills, readOutlines := []color.NRGBA{}, []color.NRGBA{}
+	err := readShapeLog(out, func(h shapeLogHeader) error {
+		readHeader = h
+		return nil
+	}, func(shape Shape, fill, outline color.NRGBA) {
+		readShapes = append(readShapes, shape)
+		readFills = append(readFills, fill)
+		readOutlines = append(readOutlines, outline)
+	})
+	if err != nil {
+		t.Fatalf("readShapeLog() error = %v", err)
+	}
+	header.Version = shapeLogVersion
+	if !reflect.DeepEqual(readHeader, header) {
+		t.Errorf("header = %+v, want %+v", readHeader, header)
+	}
+	if !reflect.DeepEqual(readShapes, shapes) {
+		t.Errorf("shapes = %+v, want %+v", readShapes, shapes)
+	}
+	if !reflect.DeepEqual(readFills, fills) || !reflect.DeepEqual(readOutlines, outlines) {
+		t.Errorf("colors = %v %v, want %v %v", readFills, readOutlines, fills, outlines)
+	}
+}
+
+func TestReadShapeLogInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		want string
+	}{
+		{"version", `{"version":99,"width":10,"height":10}`, "only version 1 is supported"},
+		{"zero width", `{"version":1,"width":0,"height":10}`, "invalid canvas size of 0x10"},
+		{"zero height", `{"version":1,"width":10,"height":0}`, "invalid canvas size of 10x0"},
+		{"unknown shape", "{\"version\":1,\"width\":10,\"height\":10}\n{\"kind\":\"star\",\"shape\":{}}", "unknown shape star on line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := readShapeLog(strings.NewReader(tt.log), func(shapeLogHeader) error { return nil }, func(Shape, color.NRGBA, color.NRGBA) {})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("readShapeLog() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package transformer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/kevineaton/art/canvas"
+)
+
+// Shape is a single primitive placed by the sketch. Shapes add their outline to the canvas and the sketch
+// decides how to fill and stroke it
+type Shape interface {
+	// Path adds the outline of the shape to the current path of the context
+	Path(dc canvas.Canvas)
+	// BrushWidth is the stroke width for shapes that are only stroked, such as lines; filled shapes return 0
+	BrushWidth() float64
+	// Bounds is a box on the canvas that contains everything the shape draws
+	Bounds() image.Rectangle
+	// Mutate returns a slightly changed copy of the shape; amount is the typical distance in pixels
+	Mutate(rng *rand.Rand, amount float64) Shape
+}
+
+// ShapeFactory creates a random instance of a shape centered on x, y. The size is the current stroke size
+// of the sketch and the rotation is in radians
+type ShapeFactory func(rng *rand.Rand, params *TransformerUserParams, x, y, size, rotation float64) Shape
+
+// shapeFactories holds the built in shapes that can be selected with the shapes flag
+var shapeFactories = map[string]ShapeFactory{
+	"polygon":   newPolygon,
+	"circle":    newCircle,
+	"ellipse":   newEllipse,
+	"line":      newLine,
+	"rectangle": newRectangle,
+	"blob":      newBlob,
+	"glyph":     newGlyph,
+}
+
+// ShapeNames returns the names of the available shapes
+func ShapeNames() []string {
+	names := make([]string, 0, len(shapeFactories))
+	for name := range shapeFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// weightedShape is a single entry of the shapes flag
+type weightedShape struct {
+	name    string
+	weight  float64
+	factory ShapeFactory
+}
+
+// shapeSet picks shapes in proportion to their weights
+type shapeSet struct {
+	shapes []weightedShape
+	total  float64
+}
+
+// parseShapes parses a list such as circle:3,polygon:1; a name without a weight has a weight of 1
+func parseShapes(input string) (*shapeSet, error) {
+	set := &shapeSet{}
+	for _, entry := range strings.Split(input, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, weightString, hasWeight := strings.Cut(entry, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		factory, ok := shapeFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown shape %s; valid shapes are %s", name, strings.Join(ShapeNames(), ", "))
+		}
+		weight := 1.0
+		if hasWeight {
+			w, err := strconv.ParseFloat(strings.TrimSpace(weightString), 64)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid weight for shape %s: %s", name, weightString)
+			}
+			weight = w
+		}
+		if weight == 0 {
+			continue
+		}
+		set.shapes = append(set.shapes, weightedShape{name: name, weight: weight, factory: factory})
+		set.total += weight
+	}
+	if len(set.shapes) == 0 {
+		return nil, errors.New("at least one shape with a positive weight is required")
+	}
+	return set, nil
+}
+
+// pick selects a shape factory; with a single shape no random value is consumed
+func (set *shapeSet) pick(rng *rand.Rand) ShapeFactory {
+	if len(set.shapes) == 1 {
+		return set.shapes[0].factory
+	}
+	target := rng.Float64() * set.total
+	for i := range set.shapes {
+		target -= set.shapes[i].weight
+		if target < 0 {
+			return set.shapes[i].factory
+		}
+	}
+	return set.shapes[len(set.shapes)-1].factory
+}
+
+// Polygon is a regular polygon, the original shape of the transformer
+type Polygon struct {
+	X, Y     float64
+	Radius   float64
+	Rotation float64
+	Edges    int
+}
+
+func newPolygon(rng *rand.Rand, params *TransformerUserParams, x, y, size, rotation float64) Shape {
+	edges := params.MinEdgeCount
+	if params.MaxEdgeCount > params.MinEdgeCount {
+		edges += rng.IntN(params.MaxEdgeCount - params.MinEdgeCount + 1)
+	}
+	if edges < 3 {
+		edges = 3
+	}
+	return &Polygon{X: x, Y: y, Radius: size, Rotation: rotation, Edges: edges}
+}
+
+func (p *Polygon) Path(dc canvas.Canvas) {
+	// this matches gg.DrawRegularPolygon so the default look is unchanged
+	angle := 2 * math.Pi / float64(p.Edges)
+	rotation := p.Rotation - math.Pi/2
+	if p.Edges%2 == 0 {
+		rotation += angle / 2
+	}
+	dc.NewSubPath()
+	for i := 0; i < p.Edges; i++ {
+		a := rotation + angle*float64(i)
+		dc.LineTo(p.X+p.Radius*math.Cos(a), p.Y+p.Radius*math.Sin(a))
+	}
+	dc.ClosePath()
+}
+
+func (p *Polygon) BrushWidth() float64 {
+	return 0
+}
+
+func (p *Polygon) Bounds() image.Rectangle {
+	return boundsAround(p.X, p.Y, p.Radius)
+}
+
+func (p *Polygon) Mutate(rng *rand.Rand, amount float64) Shape {
+	m := *p
+	m.X, m.Y = mutatePoint(rng, m.X, m.Y, amount)
+	m.Radius = mutateLength(rng, m.Radius, amount)
+	m.Rotation += rng.NormFloat64() * 0.3
+	return &m
+}
+
+// Ellipse is an ellipse rotated about its center; circles are ellipses with equal radii
+type Ellipse struct {
+	X, Y     float64
+	RadiusX  float64
+	RadiusY  float64
+	Rotation float64
+}
+
+func newCircle(rng *rand.Rand, params *TransformerUserParams, x, y, size, rotation float64) Shape {
+	return &Ellipse{X: x, Y: y, RadiusX: size, RadiusY: size, Rotation: rotation}
+}
+
+func newEllipse(rng *rand.Rand, params *TransformerUserParams, x, y, size, rotation float64) Shape {
+	return &Ellipse{X: x, Y: y, RadiusX: size, RadiusY: size * (0.25 + 0.75*rng.Float64()), Rotation: rotation}
+}
+
+func (e *Ellipse) Path(dc canvas.Canvas) {
+	// four cubic curves with the standard control point distance approximate the ellipse closely
+	const k = 0.5522847498
+	points := [][2]float64{
+		{1, 0}, {1, k}, {k, 1}, {0, 1},
+		{-k, 1}, {-1, k}, {-1, 0},
+		{-1, -k}, {-k, -1}, {0, -1},
+		{k, -1}, {1, -k}, {1, 0},
+	}
+	transformed := make([]gg.Point, len(points))
+	for i := range points {
+		transformed[i] = rotatePoint(points[i][0]*e.RadiusX, points[i][1]*e.RadiusY, e.Rotation, e.X, e.Y)
+	}
+	dc.NewSubPath()
+	dc.MoveTo(transformed[0].X, transformed[0].Y)
+	for i := 1; i+2 < len(transformed); i += 3 {
+		dc.CubicTo(transformed[i].X, transformed[i].Y, transformed[i+1].X, transformed[i+1].Y, transformed[i+2].X, transformed[i+2].Y)
+	}
+	dc.ClosePath()
+}
+
+func (e *Ellipse) BrushWidth() float64 {
+	return 0
+}
+
+func (e *Ellipse) Bounds() image.Rectangle {
+	return boundsAround(e.X, e.Y, max(e.RadiusX, e.RadiusY))
+}
+
+func (e *Ellipse) Mutate(rng *rand.Rand, amount float64) Shape {
+	m := *e
+	m.X, m.Y = mutatePoint(rng, m.X, m.Y, amount)
+	if m.RadiusX == m.RadiusY {
+		// keep circles round
+		m.RadiusX = mutateLength(rng, m.RadiusX, amount)
+		m.RadiusY = m.RadiusX
+	} else {
+		m.RadiusX = mutateLength(rng, m.RadiusX, amount)
+		m.RadiusY = mutateLength(rng, m.RadiusY, amount)
+		m.Rotation += rng.NormFloat64() * 0.3
+	}
+	return &m
+}
+
+// Rectangle is a rectangle rotated about its center
+type Rectangle struct {
+	X, Y          float64
+	Width, Height float64
+	Rotation      float64
+}
+
+func newRectangle(rng *rand.Rand, params *TransformerUserParams, x, y, size, rotation float64) Shape {
+	return &Rectangle{X: x, Y: y, Width: 2 * size, Height: 2 * size * (0.25 + 0.75*rng.Float64()), Rotation: rotation}
+}
+
+func (r *Rectangle) Path(dc canvas.Canvas) {
+	w, h := r.Width/2, r.Height/2
+	dc.NewSubPath()
+	for _, corner := range [][2]float64{{-w, -h}, {w, -h}, {w, h}, {-w, h}} {
+		p := rotatePoint(corner[0], corner[1], r.Rotation, r.X, r.Y)
+		dc.LineTo(p.X, p.Y)
+	}
+	dc.ClosePath()
+}
+
+func (r *Rectangle) BrushWidth() float64 {
+	return 0
+}
+
+func (r *Rectangle) Bounds() image.Rectangle {
+	return boundsAround(r.X, r.Y, math.Hypot(r.Width, r.Height)/2)
+}
+
+func (r *Rectangle) Mutate(rng *rand.Rand, amount float64) Shape {
+	m := *r
+	m.X, m.Y = mutatePoint(rng, m.X, m.Y, amount)
+	m.Width = mutateLength(rng, m.Width, amount)
+	m.Height = mutateLength(rng, m.Height, amount)
+	m.Rotation += rng.NormFloat64() * 0.3
+	return &m
+}
+
+// Line is a straight brush stroke through its center
+type Line struct {
+	X, Y     float64
+	Length   float64
+	Width    float64
+	Rotation float64
+}
+
+func newLine(rng *rand.Rand, params *TransformerUserParams, x, y, size, rotation float64) Shape {
+	return &Line{X: x, Y: y, Length: 2 * size, Width: math.Max(1, size*(0.1+0.2*rng.Float64())), Rotation: rotation}
+}
+
+func (l *Line) Path(dc canvas.Canvas) {
+	start := rotatePoint(-l.Length/2, 0, l.Rotation, l.X, l.Y)
+	end := rotatePoint(l.Length/2, 0, l.Rotation, l.X, l.Y)
+	dc.NewSubPath()
+	dc.MoveTo(start.X, start.Y)
+	dc.LineTo(end.X, end.Y)
+}
+
+func (l *Line) BrushWidth() float64 {
+	return l.Width
+}
+
+func (l *Line) Bounds() image.Rectangle {
+	return boundsAround(l.X, l.Y, l.Length/2+l.Width)
+}
+
+func (l *Line) Mutate(rng *rand.Rand, amount float64) Shape {
+	m := *l
+	m.X, m.Y = mutatePoint(rng, m.X, m.Y, amount)
+	m.Length = mutateLength(rng, m.Length, amount)
+	m.Width = max(1, mutateLength(rng, m.Width, amount/4))
+	m.Rotation += rng.NormFloat64() * 0.3
+	return &m
+}
+
+// Blob is an irregular closed curve passing smoothly through points placed around its center
+type Blob struct {
+	Points []gg.Point
+}
+
+func newBlob(rng *rand.Rand, params *TransformerUserParams, x, y, size, rotation float64) Shape {
+	count := 4 + rng.IntN(4)
+	b := &Blob{Points: make([]gg.Point, count)}
+	for i := range b.Points {
+		angle := rotation + 2*math.Pi*float64(i)/float64(count)
+		radius := size * (0.5 + 0.5*rng.Float64())
+		b.Points[i] = gg.Point{X: x + radius*math.Cos(angle), Y: y + radius*math.Sin(angle)}
+	}
+	return b
+}
+
+func (b *Blob) Path(dc canvas.Canvas) {
+	// convert the closed Catmull-Rom spline through the points into cubic curves
+	n := len(b.Points)
+	dc.NewSubPath()
+	dc.MoveTo(b.Points[0].X, b.Points[0].Y)
+	for i := 0; i < n; i++ {
+		p0 := b.Points[(i-1+n)%n]
+		p1 := b.Points[i]
+		p2 := b.Points[(i+1)%n]
+		p3 := b.Points[(i+2)%n]
+		dc.CubicTo(
+			p1.X+(p2.X-p0.X)/6, p1.Y+(p2.Y-p0.Y)/6,
+			p2.X-(p3.X-p1.X)/6, p2.Y-(p3.Y-p1.Y)/6,
+			p2.X, p2.Y,
+		)
+	}
+	dc.ClosePath()
+}
+
+func (b *Blob) BrushWidth() float64 {
+	return 0
+}
+
+func (b *Blob) Bounds() image.Rectangle {
+	// the curves stay within their control points, which are never more than half the distance
+	// between neighbors beyond the points themselves
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range b.Points {
+		minX, minY = math.Min(minX, p.X), math.Min(minY, p.Y)
+		maxX, maxY = math.Max(maxX, p.X), math.Max(maxY, p.Y)
+	}
+	padX, padY := (maxX-minX)/3, (maxY-minY)/3
+	return image.Rect(int(minX-padX)-1, int(minY-padY)-1, int(maxX+padX)+2, int(maxY+padY)+2)
+}
+
+func (b *Blob) Mutate(rng *rand.Rand, amount float64) Shape {
+	m := &Blob{Points: make([]gg.Point, len(b.Points))}
+	dx, dy := rng.NormFloat64()*amount/2, rng.NormFloat64()*amount/2
+	for i, p := range b.Points {
+		m.Points[i] = gg.Point{X: p.X + dx + rng.NormFloat64()*amount/4, Y: p.Y + dy + rng.NormFloat64()*amount/4}
+	}
+	return m
+}
+
+// boundsAround returns the box containing a circle, padded for the outline
+func boundsAround(x, y, radius float64) image.Rectangle {
+	return image.Rect(int(x-radius)-2, int(y-radius)-2, int(x+radius)+3, int(y+radius)+3)
+}
+
+// mutatePoint moves a point by a random amount
+func mutatePoint(rng *rand.Rand, x, y, amount float64) (float64, float64) {
+	return x + rng.NormFloat64()*amount/2, y + rng.NormFloat64()*amount/2
+}
+
+// mutateLength grows or shrinks a length by a random amount without letting it collapse
+func mutateLength(rng *rand.Rand, length, amount float64) float64 {
+	return math.Max(1, length+rng.NormFloat64()*amount/4)
+}
+
+// rotatePoint rotates x, y about the origin and then moves it to be relative to cx, cy
+func rotatePoint(x, y, rotation, cx, cy float64) gg.Point {
+	sin, cos := math.Sincos(rotation)
+	return gg.Point{X: cx + x*cos - y*sin, Y: cy + x*sin + y*cos}
+}
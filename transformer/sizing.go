@@ -0,0 +1,178 @@
+package transformer
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	// ResizeFit keeps the aspect ratio of the source and fits the canvas inside the destination size
+	ResizeFit = "fit"
+	// ResizeFill uses the destination size and trims the center of the source to match it
+	ResizeFill = "fill"
+	// ResizeStretch uses the destination size and scales each axis of the source independently
+	ResizeStretch = "stretch"
+	// ResizeCrop uses the destination size and trims the source to its most detailed region
+	ResizeCrop = "crop"
+)
+
+// resizeModes is used to validate the resize-mode flag
+var resizeModes = []string{ResizeFit, ResizeFill, ResizeStretch, ResizeCrop}
+
+// sizePresets are common destination sizes that can be selected by name instead of a width and height
+var sizePresets = map[string][2]int{
+	"square":       {1080, 1080},
+	"portrait":     {1080, 1350},
+	"story":        {1080, 1920},
+	"wallpaper":    {1920, 1080},
+	"wallpaper-4k": {3840, 2160},
+	"print-4x6":    {1200, 1800},
+	"print-4x5":    {2400, 3000},
+	"print-a4":     {2480, 3508},
+}
+
+// SizePresetNames returns the names of the available size presets
+func SizePresetNames() []string {
+	names := make([]string, 0, len(sizePresets))
+	for name := range sizePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateSizing makes sure the resize mode and size preset are ones we know about
+func validateSizing(params *TransformerUserParams) error {
+	known := false
+	for _, mode := range resizeModes {
+		if params.ResizeMode == mode {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("invalid resize mode %s; valid modes are %s", params.ResizeMode, strings.Join(resizeModes, ", "))
+	}
+	if _, ok := sizePresets[params.SizePreset]; params.SizePreset != "" && !ok {
+		return fmt.Errorf("invalid size preset %s; valid presets are %s", params.SizePreset, strings.Join(SizePresetNames(), ", "))
+	}
+	if params.Scale <= 0 {
+		return fmt.Errorf("invalid scale %v; it must be greater than 0", params.Scale)
+	}
+	return nil
+}
+
+// fitCanvas works out the size of the canvas for a source and returns the region of the source that should
+// be mapped onto it
+func fitCanvas(source image.Image, params *TransformerUserParams) (image.Rectangle, int, int) {
+	bounds := source.Bounds()
+	sourceWidth, sourceHeight := float64(bounds.Dx()), float64(bounds.Dy())
+	aspect := sourceWidth / sourceHeight
+
+	// the box the canvas has to work with; a missing side is taken from the source or its aspect ratio
+	width, height := float64(params.DestWidth), float64(params.DestHeight)
+	if preset, ok := sizePresets[params.SizePreset]; ok {
+		width, height = float64(preset[0]), float64(preset[1])
+	}
+	switch {
+	case width == 0 && height == 0:
+		width, height = sourceWidth, sourceHeight
+	case width == 0:
+		width = height * aspect
+	case height == 0:
+		height = width / aspect
+	}
+	scale := params.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	width, height = width*scale, height*scale
+
+	switch params.ResizeMode {
+	case ResizeStretch:
+		return bounds, max(1, int(math.Round(width))), max(1, int(math.Round(height)))
+	case ResizeFill, ResizeCrop:
+		cropWidth, cropHeight := sourceWidth, sourceHeight
+		if aspect > width/height {
+			cropWidth = sourceHeight * width / height
+		} else {
+			cropHeight = sourceWidth * height / width
+		}
+		var offset image.Point
+		if params.ResizeMode == ResizeCrop {
+			offset = detailedCrop(source, int(cropWidth), int(cropHeight))
+		} else {
+			offset = image.Pt(int((sourceWidth-cropWidth)/2), int((sourceHeight-cropHeight)/2))
+		}
+		crop := image.Rect(0, 0, max(1, int(cropWidth)), max(1, int(cropHeight))).Add(bounds.Min.Add(offset))
+		return crop, max(1, int(math.Round(width))), max(1, int(math.Round(height)))
+	}
+
+	// fit the source inside the box
+	if aspect > width/height {
+		height = width / aspect
+	} else {
+		width = height * aspect
+	}
+	return bounds, max(1, int(math.Round(width))), max(1, int(math.Round(height)))
+}
+
+// cropImage copies the region of the image so it starts at 0, 0; the image is returned as is if the region
+// already covers all of it
+func cropImage(img image.Image, crop image.Rectangle) image.Image {
+	if crop == img.Bounds() && crop.Min == (image.Point{}) {
+		return img
+	}
+	cropped := image.NewNRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, crop.Min, draw.Src)
+	return cropped
+}
+
+// detailedCrop slides a window of the given size along the source and returns the offset of the window
+// with the most edge detail
+func detailedCrop(source image.Image, cropWidth, cropHeight int) image.Point {
+	bounds := source.Bounds()
+	gray, cols, rows := grayscaleGrid(source)
+	energy := sobelMagnitude(gray, cols, rows)
+	scaleX := float64(cols) / float64(bounds.Dx())
+	scaleY := float64(rows) / float64(bounds.Dy())
+
+	// only one axis is ever trimmed, so sum the energy along the other one
+	horizontal := cropWidth < bounds.Dx()
+	length, window := rows, int(float64(cropHeight)*scaleY)
+	if horizontal {
+		length, window = cols, int(float64(cropWidth)*scaleX)
+	}
+	lines := make([]float64, length)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			if horizontal {
+				lines[x] += energy[y*cols+x]
+			} else {
+				lines[y] += energy[y*cols+x]
+			}
+		}
+	}
+
+	window = max(1, min(window, length))
+	best, bestStart, sum := -1.0, 0, 0.0
+	for i := 0; i < length; i++ {
+		sum += lines[i]
+		if i >= window {
+			sum -= lines[i-window]
+		}
+		if i >= window-1 && sum > best {
+			best, bestStart = sum, i-window+1
+		}
+	}
+
+	if horizontal {
+		x := min(int(float64(bestStart)/scaleX), bounds.Dx()-cropWidth)
+		return image.Pt(max(0, x), 0)
+	}
+	y := min(int(float64(bestStart)/scaleY), bounds.Dy()-cropHeight)
+	return image.Pt(0, max(0, y))
+}
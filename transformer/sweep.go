@@ -0,0 +1,435 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"github.com/kevineaton/art/imageutils"
+	"github.com/kevineaton/art/progressbar"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	xdraw "golang.org/x/image/draw"
+)
+
+// the layout of a contact sheet, in pixels
+const (
+	sweepPadding    = 16
+	sweepFontSize   = 14
+	sweepLineHeight = 20
+)
+
+// SweepParams are the options for a parameter sweep; Params holds the sketch flags shared by every cell
+type SweepParams struct {
+	Params        TransformerUserParams
+	Vary          []string
+	Output        string
+	OutputOptions string
+	CellWidth     int
+}
+
+// sweepAxis is one varied flag and the values it takes
+type sweepAxis struct {
+	flag   string
+	values []string
+}
+
+// sweepCell is one combination of values and what it produced
+type sweepCell struct {
+	values []string
+	params TransformerUserParams
+	img    image.Image
+	err    error
+}
+
+// GetSweepCommand returns the command that renders every combination of a few flags for one input
+func GetSweepCommand() *cobra.Command {
+	params := &SweepParams{}
+	defaults := DefaultParams()
+	cmd := &cobra.Command{
+		Use:   "sweep <input>",
+		Short: "Transform one image with every combination of a few flags and compare them on a labelled sheet",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := Sweep(cmd.Context(), args[0], params); err != nil {
+				return commandError(cmd, os.Stdout, err)
+			}
+			fmt.Printf("Done!\n")
+			return nil
+		},
+	}
+	addSketchFlags(cmd.Flags(), &params.Params, defaults)
+	cmd.Flags().StringArrayVar(&params.Vary, "vary", nil, "A flag to vary and its values, such as stroke-ratio=0.5,0.75,1 or alpha-increase=0.02:0.1:0.02 for a range with a step; use ; between values that hold commas, and repeat to vary more flags")
+	cmd.Flags().StringVar(&params.Output, "output", defaults.Output, "The directory to save the sheet in, or the name of the sheet as a png, jpg, gif, bmp, or tiff")
+	cmd.Flags().StringVar(&params.OutputOptions, "output-options", defaults.OutputOptions, outputOptionsHelp)
+	cmd.Flags().IntVar(&params.CellWidth, "cell-width", 320, "The width of each result on the sheet")
+	cmd.Flags().IntVar(&params.Params.Workers, "workers", defaults.Workers, "The number of combinations to transform in parallel")
+	return cmd
+}
+
+// Sweep transforms the input once for every combination of the varied flags, all with the same seed, and
+// saves a sheet with the results in a grid, each labelled with the values that produced it
+func Sweep(ctx context.Context, input string, params *SweepParams) error {
+	if len(params.Vary) == 0 {
+		return errors.New("nothing to sweep; pass at least one --vary such as --vary stroke-ratio=0.5,1")
+	}
+	axes := []sweepAxis{}
+	for _, vary := range params.Vary {
+		axis, err := parseSweepAxis(vary, params.Params)
+		if err != nil {
+			return err
+		}
+		axes = append(axes, axis)
+	}
+	base := params.Params
+	if base.Seed == 0 {
+		base.Seed = newSeed()
+	}
+	fmt.Printf("Using seed %d\n", base.Seed)
+
+	source, hash, err := loadSource(input)
+	if err != nil {
+		return err
+	}
+	cells, err := sweepCells(axes, base)
+	if err != nil {
+		return err
+	}
+	format, output, err := sweepOutput(params.Output, input, base.Seed)
+	if err != nil {
+		return err
+	}
+	encoding, err := imageutils.ParseEncodeOptions(params.OutputOptions)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Transforming %d combinations of %d flags\n", len(cells), len(axes))
+
+	runSweep(ctx, filepath.Base(input), source, cells, base.Workers)
+	if ctx.Err() != nil {
+		return errors.New("stopped early, so no sheet was saved")
+	}
+	for _, cell := range cells {
+		if cell.err != nil {
+			fmt.Printf("%s: %v\n", strings.Join(sweepLabel(axes, cell), ", "), cell.err)
+		}
+	}
+
+	sheet, err := sweepSheet(axes, cells, params.CellWidth, fmt.Sprintf("%s, seed %d", filepath.Base(input), base.Seed))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("could not create the output directory: %w", err)
+	}
+	err = imageutils.SaveImage(sheet, format, output, imageutils.Metadata{
+		MetadataSoftware:     "art " + toolVersion(),
+		MetadataVersion:      toolVersion(),
+		MetadataCommand:      commandLine(),
+		MetadataSeed:         strconv.FormatInt(base.Seed, 10),
+		MetadataSource:       input,
+		MetadataSourceSHA256: hash,
+	}, encoding)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved the sheet to %s\n", output)
+	return nil
+}
+
+// parseSweepAxis reads a --vary, checking that the flag is one that shapes a sketch and that every value is
+// valid for it. A single value written as start:end:step is expanded into a range that includes the end
+func parseSweepAxis(vary string, base TransformerUserParams) (sweepAxis, error) {
+	name, list, ok := strings.Cut(vary, "=")
+	name = strings.TrimPrefix(strings.TrimSpace(name), "--")
+	if !ok || name == "" || list == "" {
+		return sweepAxis{}, fmt.Errorf("invalid vary %s; it must be written as flag=values", vary)
+	}
+	if name == "seed" {
+		return sweepAxis{}, errors.New("the seed cannot be varied, since it is what keeps the cells comparable")
+	}
+	separator := ","
+	if strings.Contains(list, ";") {
+		separator = ";"
+	}
+	axis := sweepAxis{flag: name}
+	for _, value := range strings.Split(list, separator) {
+		value = strings.TrimSpace(value)
+		expanded, err := expandSweepRange(value)
+		if err != nil {
+			return sweepAxis{}, err
+		}
+		axis.values = append(axis.values, expanded...)
+	}
+	for _, value := range axis.values {
+		if _, err := sweepParams(base, map[string]string{name: value}); err != nil {
+			return sweepAxis{}, err
+		}
+	}
+	return axis, nil
+}
+
+// expandSweepRange turns start:end:step into each value of the range, and leaves anything else as it is
+func expandSweepRange(value string) ([]string, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return []string{value}, nil
+	}
+	numbers := make([]float64, 3)
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			// values such as shape weights also hold colons
+			return []string{value}, nil
+		}
+		numbers[i] = number
+	}
+	start, end, step := numbers[0], numbers[1], numbers[2]
+	if step <= 0 || end < start {
+		return nil, fmt.Errorf("invalid range %s; it must be start:end:step with a positive step and the end after the start", value)
+	}
+	if (end-start)/step > 1000 {
+		return nil, fmt.Errorf("the range %s has too many values", value)
+	}
+	values := []string{}
+	// the small allowance keeps the end in the range despite rounding in the steps
+	for i := 0; start+float64(i)*step <= end+step*1e-9; i++ {
+		v := math.Round((start+float64(i)*step)*1e9) / 1e9
+		values = append(values, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return values, nil
+}
+
+// sweepParams applies values to a copy of the base params by setting them as flags, so they are parsed
+// exactly as they would be on the command line
+func sweepParams(base TransformerUserParams, values map[string]string) (TransformerUserParams, error) {
+	params := base
+	flags := pflag.NewFlagSet("sweep", pflag.ContinueOnError)
+	addSketchFlags(flags, &params, base)
+	for name, value := range values {
+		if flags.Lookup(name) == nil {
+			return params, fmt.Errorf("%s cannot be varied; only the flags that shape the sketch can", name)
+		}
+		if err := flags.Set(name, value); err != nil {
+			return params, fmt.Errorf("invalid value %s for %s: %w", value, name, err)
+		}
+	}
+	return params, nil
+}
+
+// sweepCells lists every combination of the values, with the last flag changing fastest
+func sweepCells(axes []sweepAxis, base TransformerUserParams) ([]*sweepCell, error) {
+	combinations := [][]string{{}}
+	for _, axis := range axes {
+		next := [][]string{}
+		for _, combination := range combinations {
+			for _, value := range axis.values {
+				next = append(next, append(append([]string{}, combination...), value))
+			}
+		}
+		combinations = next
+	}
+	cells := make([]*sweepCell, len(combinations))
+	for i, combination := range combinations {
+		values := map[string]string{}
+		for j, axis := range axes {
+			values[axis.flag] = combination[j]
+		}
+		params, err := sweepParams(base, values)
+		if err != nil {
+			return nil, err
+		}
+		cells[i] = &sweepCell{values: combination, params: params}
+	}
+	return cells, nil
+}
+
+// sweepOutput works out where the sheet goes; a directory gets a name made from the input and the seed
+func sweepOutput(output, input string, seed int64) (imageutils.ImageFormat, string, error) {
+	if output == "" {
+		output = "./output"
+	}
+	if extension := strings.TrimPrefix(filepath.Ext(output), "."); extension != "" {
+		format, err := imageutils.GetImageFormatFromString(extension)
+		if err == nil && format != imageutils.ImageFormatSVG {
+			return format, output, nil
+		}
+		if err == nil {
+			return "", "", errors.New("the sheet cannot be an svg")
+		}
+	}
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	if input == stdio {
+		name = strings.TrimSuffix(stdinName, filepath.Ext(stdinName))
+	}
+	name, _ = claimOutput(output, fmt.Sprintf("%s_sweep_seed%d.png", name, seed), OnExistsIncrement, map[string]bool{})
+	return imageutils.ImageFormatPNG, filepath.Join(output, name), nil
+}
+
+// runSweep transforms the cells on a pool of workers, reporting them on a single bar
+func runSweep(ctx context.Context, inputName string, source image.Image, cells []*sweepCell, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	totalCycles := 0
+	for _, cell := range cells {
+		totalCycles += cell.params.TotalCycles
+	}
+	bar := progressbar.NewMultiBar(&progressbar.BarOptions{
+		Max:          totalCycles,
+		Width:        50,
+		EnableColors: true,
+		Description:  "Sweeping",
+	}, len(cells))
+
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if ctx.Err() != nil {
+					continue
+				}
+				name := fmt.Sprintf("%d/%d", i+1, len(cells))
+				bar.Start(name)
+				cells[i].img, cells[i].err = sweepTransform(ctx, inputName, source, cells[i], bar)
+				bar.Finish(name)
+			}
+		}()
+	}
+queueing:
+	for i := range cells {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break queueing
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if ctx.Err() != nil {
+		bar.Stop()
+	} else {
+		bar.Close()
+	}
+	fmt.Printf("\n")
+}
+
+// sweepTransform transforms the source with the params of one cell
+func sweepTransform(ctx context.Context, inputName string, source image.Image, cell *sweepCell, bar *progressbar.MultiBar) (image.Image, error) {
+	opts := []Option{WithParams(cell.params)}
+	if path := findMask(inputName, &cell.params); path != "" {
+		mask, err := imageutils.LoadImage(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the mask: %w", err)
+		}
+		opts = append(opts, WithMask(mask))
+	}
+	done := 0
+	opts = append(opts, WithProgress(progressBatchSize, func(p Progress) {
+		bar.Add(p.Cycle - done)
+		done = p.Cycle
+	}))
+	sketch, err := runTransform(ctx, source, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sketch.output(), nil
+}
+
+// sweepLabel is the values of a cell as flag=value
+func sweepLabel(axes []sweepAxis, cell *sweepCell) []string {
+	label := make([]string, len(axes))
+	for i, axis := range axes {
+		label[i] = axis.flag + "=" + cell.values[i]
+	}
+	return label
+}
+
+// sweepSheet lays the cells out in a grid under a title. With more than one flag each row holds the values
+// of the last flag, so the columns line up; a single flag is wrapped into a roughly square grid
+func sweepSheet(axes []sweepAxis, cells []*sweepCell, cellWidth int, title string) (image.Image, error) {
+	if cellWidth < 16 {
+		return nil, fmt.Errorf("invalid cell-width %d; it must be at least 16", cellWidth)
+	}
+	columns := len(axes[len(axes)-1].values)
+	if len(axes) == 1 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(cells)))))
+	}
+	rows := (len(cells) + columns - 1) / columns
+
+	// every cell is as tall as the tallest result, so results of different sizes still line up
+	cellHeight := 0
+	for _, cell := range cells {
+		if cell.img != nil {
+			bounds := cell.img.Bounds()
+			cellHeight = max(cellHeight, int(math.Round(float64(cellWidth)*float64(bounds.Dy())/float64(bounds.Dx()))))
+		}
+	}
+	if cellHeight == 0 {
+		cellHeight = cellWidth
+	}
+	labelHeight := len(axes)*sweepLineHeight + sweepPadding/2
+	width := columns*cellWidth + (columns+1)*sweepPadding
+	height := sweepLineHeight + sweepPadding*2 + rows*(cellHeight+labelHeight+sweepPadding)
+
+	goFont, err := loadGoFont()
+	if err != nil {
+		return nil, fmt.Errorf("could not load the font for the labels: %w", err)
+	}
+	dc := gg.NewContext(width, height)
+	dc.SetColor(color.White)
+	dc.Clear()
+	dc.SetFontFace(truetype.NewFace(goFont, &truetype.Options{Size: sweepFontSize}))
+	dc.SetColor(color.Black)
+	dc.DrawStringAnchored(title, sweepPadding, sweepPadding+sweepLineHeight/2, 0, 0.5)
+
+	sheet := dc.Image().(*image.RGBA)
+	for i, cell := range cells {
+		x := sweepPadding + (i%columns)*(cellWidth+sweepPadding)
+		y := sweepLineHeight + sweepPadding*2 + (i/columns)*(cellHeight+labelHeight+sweepPadding)
+		if cell.img == nil {
+			dc.SetColor(color.Gray{Y: 220})
+			dc.DrawRectangle(float64(x), float64(y), float64(cellWidth), float64(cellHeight))
+			dc.Fill()
+			dc.SetColor(color.Black)
+			dc.DrawStringAnchored("failed", float64(x+cellWidth/2), float64(y+cellHeight/2), 0.5, 0.5)
+		} else {
+			bounds := cell.img.Bounds()
+			h := int(math.Round(float64(cellWidth) * float64(bounds.Dy()) / float64(bounds.Dx())))
+			xdraw.CatmullRom.Scale(sheet, image.Rect(x, y, x+cellWidth, y+h), cell.img, bounds, xdraw.Over, nil)
+		}
+		dc.SetColor(color.Black)
+		for j, line := range sweepLabel(axes, cell) {
+			dc.DrawStringAnchored(fitLabel(dc, line, float64(cellWidth)), float64(x), float64(y+cellHeight+sweepPadding/2+j*sweepLineHeight+sweepLineHeight/2), 0, 0.5)
+		}
+	}
+	return sheet, nil
+}
+
+// fitLabel shortens a label that is wider than its cell, so it does not run into the next one
+func fitLabel(dc *gg.Context, label string, width float64) string {
+	if w, _ := dc.MeasureString(label); w <= width {
+		return label
+	}
+	runes := []rune(label)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if w, _ := dc.MeasureString(string(runes) + "…"); w <= width {
+			break
+		}
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,241 @@
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/kevineaton/art/imageutils"
+)
+
+// Progress is passed to the progress callback as a transform runs
+type Progress struct {
+	Cycle       int
+	TotalCycles int
+}
+
+// Option changes how Transform runs
+type Option func(*options)
+
+// options are collected from the Option values passed to Transform
+type options struct {
+	params        TransformerUserParams
+	mask          image.Image
+	progress      func(Progress)
+	progressEvery int
+	frames        func(frame image.Image, cycle int) error
+	frameEvery    int
+	shapeLog      io.Writer
+
+	// these are only used by the command line
+	config         *sketchConfig
+	sourcePath     string
+	resume         *checkpoint
+	shapeLogOffset int64
+	checkpoint     func(s *TransformerSketch) error
+}
+
+// WithParams replaces every param; start from DefaultParams and change what is needed
+func WithParams(params TransformerUserParams) Option {
+	return func(o *options) {
+		o.params = params
+	}
+}
+
+// WithSeed sets the seed; the same seed, source, and params always produce the same output
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.params.Seed = seed
+	}
+}
+
+// WithCycles sets how many shapes are placed
+func WithCycles(cycles int) Option {
+	return func(o *options) {
+		o.params.TotalCycles = cycles
+	}
+}
+
+// WithSize sets the size of the output; a side of 0 keeps the aspect ratio of the source
+func WithSize(width, height int) Option {
+	return func(o *options) {
+		o.params.DestWidth, o.params.DestHeight = width, height
+	}
+}
+
+// WithOutputType sets the format written by TransformStream; png, jpg, gif, bmp, tiff, or svg
+func WithOutputType(outputType string) Option {
+	return func(o *options) {
+		o.params.OutputFileType = outputType
+	}
+}
+
+// WithMask steers the transform with a grayscale mask, which is stretched over the source
+func WithMask(mask image.Image) Option {
+	return func(o *options) {
+		o.mask = mask
+	}
+}
+
+// WithProgress calls fn every this many cycles and once more when the transform stops
+func WithProgress(every int, fn func(Progress)) Option {
+	return func(o *options) {
+		o.progressEvery, o.progress = every, fn
+	}
+}
+
+// WithFrames calls fn with the canvas every this many cycles and once more when the transform stops, which is
+// how animations are made. The frame is only valid until fn returns, and an error stops the transform
+func WithFrames(every int, fn func(frame image.Image, cycle int) error) Option {
+	return func(o *options) {
+		o.frameEvery, o.frames = every, fn
+	}
+}
+
+// WithShapeLog writes every shape that is drawn to w as JSON lines, which art render can replay at any size
+func WithShapeLog(w io.Writer) Option {
+	return func(o *options) {
+		o.shapeLog = w
+	}
+}
+
+// Transform paints src with shapes and returns the result. If the context is cancelled, the canvas painted so
+// far is returned along with the error from the context
+func Transform(ctx context.Context, src image.Image, opts ...Option) (image.Image, error) {
+	sketch, err := runTransform(ctx, src, opts...)
+	if sketch == nil {
+		return nil, err
+	}
+	return sketch.output(), err
+}
+
+// TransformStream decodes a source from r, transforms it, and encodes the result to w in the output type. If
+// the context is cancelled, the canvas painted so far is encoded and the error from the context is returned
+func TransformStream(ctx context.Context, r io.Reader, w io.Writer, opts ...Option) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("could not load image: %w", err)
+	}
+	// the source is turned upright by its EXIF orientation, the same as on the command line
+	src, err := imageutils.DecodeImage(data)
+	if err != nil {
+		return err
+	}
+	sketch, runErr := runTransform(ctx, src, opts...)
+	if sketch == nil || (runErr != nil && ctx.Err() == nil) {
+		return runErr
+	}
+	if sketch.vector != nil {
+		_, err = sketch.vector.WriteTo(w)
+	} else {
+		format, _ := imageutils.GetImageFormatFromString(sketch.OutputFileType)
+		err = imageutils.EncodeImage(w, sketch.output(), format, newMetadata(sketch), sketch.encoding)
+	}
+	if err != nil {
+		return err
+	}
+	return runErr
+}
+
+// runTransform builds the sketch and runs its cycles, returning the sketch so the command line can save
+// everything it needs from it. The sketch is returned with the context error if the run was cancelled
+func runTransform(ctx context.Context, src image.Image, opts ...Option) (*TransformerSketch, error) {
+	o := &options{params: DefaultParams(), progressEvery: progressBatchSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+	params := &TransformerUserParams{}
+	*params = o.params
+	if params.Seed == 0 {
+		params.Seed = newSeed()
+	}
+
+	format, err := imageutils.GetImageFormatFromString(params.OutputFileType)
+	if err != nil {
+		format = imageutils.ImageFormatPNG
+		params.OutputFileType = string(format)
+	}
+	config := o.config
+	if config == nil {
+		if config, err = newSketchConfig(params, format); err != nil {
+			return nil, err
+		}
+	}
+	var mask *weightMap
+	if o.mask != nil {
+		mask = newWeightMap(o.mask, src.Bounds())
+	}
+
+	var sketch *TransformerSketch
+	if o.resume != nil {
+		if sketch, err = restoreSketch(o.resume, src, mask, config); err != nil {
+			return nil, err
+		}
+		params = sketch.TransformerUserParams
+	} else {
+		sketch = newTransformerSketch(src, mask, params, config)
+	}
+
+	if o.shapeLog != nil {
+		sketch.shapeLog = newShapeLog(o.shapeLog, o.shapeLogOffset)
+		if o.shapeLogOffset == 0 {
+			header := shapeLogHeader{
+				Width:      sketch.DestWidth,
+				Height:     sketch.DestHeight,
+				Background: sketch.Background,
+				Source:     o.sourcePath,
+				Crop:       sketch.crop,
+			}
+			if sketch.mask != nil {
+				if header.Mask, err = sketch.mask.encode(); err != nil {
+					return nil, err
+				}
+			}
+			if err := sketch.shapeLog.writeHeader(header); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	progressEvery := max(1, o.progressEvery)
+	frameEvery := max(1, o.frameEvery)
+	reported, captured := sketch.cycle, sketch.cycle
+	for sketch.cycle < params.TotalCycles && ctx.Err() == nil {
+		sketch.update()
+		if o.progress != nil && sketch.cycle%progressEvery == 0 {
+			o.progress(Progress{Cycle: sketch.cycle, TotalCycles: params.TotalCycles})
+			reported = sketch.cycle
+		}
+		if o.frames != nil && (sketch.cycle%frameEvery == 0 || sketch.cycle == params.TotalCycles) {
+			if err := o.frames(sketch.output(), sketch.cycle); err != nil {
+				return sketch, err
+			}
+			captured = sketch.cycle
+		}
+		if o.checkpoint != nil && params.CheckpointEvery > 0 && sketch.cycle%params.CheckpointEvery == 0 && sketch.cycle < params.TotalCycles {
+			if err := o.checkpoint(sketch); err != nil {
+				return sketch, err
+			}
+		}
+	}
+
+	// a cancelled run still reports everything painted so far, including the last few cycles of an animation
+	if o.progress != nil && reported != sketch.cycle {
+		o.progress(Progress{Cycle: sketch.cycle, TotalCycles: params.TotalCycles})
+	}
+	if o.frames != nil && captured != sketch.cycle {
+		if err := o.frames(sketch.output(), sketch.cycle); err != nil {
+			return sketch, err
+		}
+	}
+	if sketch.shapeLog != nil {
+		if err := sketch.shapeLog.flush(); err != nil {
+			return sketch, err
+		}
+	}
+	if sketch.cycle < params.TotalCycles {
+		return sketch, ctx.Err()
+	}
+	return sketch, nil
+}
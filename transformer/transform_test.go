@@ -0,0 +1,57 @@
+package transformer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestTransformStreamCancelled(t *testing.T) {
+	src := &bytes.Buffer{}
+	if err := png.Encode(src, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := &bytes.Buffer{}
+	err := TransformStream(ctx, src, out, WithSize(40, 30), WithCycles(100))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("TransformStream() error = %v, want %v", err, context.Canceled)
+	}
+	img, err := png.Decode(out)
+	if err != nil {
+		t.Fatalf("the partial output is not a png: %v", err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(40, 30) {
+		t.Errorf("the partial output is %v, want 40x30", got)
+	}
+}
+
+func TestTransformStreamOrientsJPEG(t *testing.T) {
+	encoded := &bytes.Buffer{}
+	if err := jpeg.Encode(encoded, image.NewRGBA(image.Rect(0, 0, 40, 20)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// an EXIF block in an APP1 segment that says the photo was taken on its side, orientation 6
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	segment := binary.BigEndian.AppendUint16([]byte{0xff, 0xe1}, uint16(len(exif)+2))
+	src := append(append(append([]byte{0xff, 0xd8}, segment...), exif...), encoded.Bytes()[2:]...)
+
+	out := &bytes.Buffer{}
+	if err := TransformStream(context.Background(), bytes.NewReader(src), out, WithSize(10, 0), WithCycles(10)); err != nil {
+		t.Fatalf("TransformStream() error = %v", err)
+	}
+	img, err := png.Decode(out)
+	if err != nil {
+		t.Fatalf("the output is not a png: %v", err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(10, 20) {
+		t.Errorf("the output is %v, want the upright 10x20", got)
+	}
+}
@@ -1,23 +1,29 @@
 package transformer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"io/ioutil"
-	"log"
-	"math/rand"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	_ "image/jpeg"
 
 	"github.com/fogleman/gg"
 	"github.com/jinzhu/copier"
+	"github.com/kevineaton/art/canvas"
 	"github.com/kevineaton/art/imageutils"
 	"github.com/kevineaton/art/progressbar"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 type TransformerUserParams struct {
@@ -34,167 +40,863 @@ type TransformerUserParams struct {
 	MaxEdgeCount             int
 	OutputFileType           string
 	TotalCycles              int
+	Seed                     int64
+	Workers                  int
+	AnimationType            string
+	FrameEvery               int
+	FrameDelay               int
+	AnimationLoops           int
+	AnimationHold            int
+	Shapes                   string
+	Glyphs                   string
+	Mode                     string
+	ClimbSteps               int
+	Sampling                 string
+	ResizeMode               string
+	Scale                    float64
+	SizePreset               string
+	Background               string
+	StrokeSchedule           string
+	AlphaSchedule            string
+	JitterSchedule           string
+	Mask                     string
+	MaskDir                  string
+	MaskStrokeScale          float64
+	CheckpointEvery          int
+	Resume                   string
+	Extend                   int
+	Orientation              string
+	Elongation               float64
+	ShapeLog                 bool
+	Inputs                   []string
+	Output                   string
+	Recursive                bool
+	Watch                    bool
+	NameTemplate             string
+	OnExists                 string
+	OutputOptions            string
 }
 
+// sketchConfig holds the parts of the user params that are parsed and validated once for the whole run
+type sketchConfig struct {
+	shapes         *shapeSet
+	strokeSchedule *schedule
+	alphaSchedule  *schedule
+	jitterSchedule *schedule
+	encoding       *imageutils.EncodeOptions
+}
+
+// outputOptionsHelp describes the encoder options for every command that saves images
+const outputOptionsHelp = "Encoder options as key=value pairs separated by commas; quality from 1 to 100 for jpg, compression of none, fast, default, or best for png and tiff, and colors from 2 to 256 for a paletted png or a gif"
+
+// progressBatchSize is how many cycles a worker runs before reporting to the progress bar
+const progressBatchSize = 100
+
 type TransformerSketch struct {
 	*TransformerUserParams
+	*sketchConfig
 	source            image.Image
 	dc                *gg.Context
+	drawing           canvas.Canvas
+	vector            *canvas.SVG
 	sourceWidth       int
 	sourceHeight      int
 	strokeSize        float64
 	initialStrokeSize float64
+	rng               *rand.Rand
+	pcg               *rand.PCG
+	initialJitter     float64
+	cycle             int
+	climb             *climber
+	sampler           sampler
+	mask              *weightMap
+	crop              image.Rectangle
+	scheduleCycles    int
+	orientation       *orientationField
+	shapeLog          *shapeLog
+	// original is the params as they were given, since the sketch changes some of them as it runs
+	original TransformerUserParams
+}
+
+// DefaultParams returns the params the transform command uses when no flags are set
+func DefaultParams() TransformerUserParams {
+	return TransformerUserParams{
+		DestWidth:                1000,
+		DestHeight:               1000,
+		ResizeMode:               ResizeFit,
+		Scale:                    1,
+		StrokeJitterRatio:        .001,
+		StrokeRatio:              .75,
+		StrokeReduction:          .002,
+		StrokeInversionThreshold: .05,
+		InitialAlpha:             .1,
+		AlphaIncrease:            .02,
+		MinEdgeCount:             3,
+		MaxEdgeCount:             4,
+		Shapes:                   "polygon:1",
+		Glyphs:                   defaultGlyphs,
+		Mode:                     ModePaint,
+		Sampling:                 SamplingUniform,
+		Orientation:              OrientationRandom,
+		Elongation:               1,
+		MaskStrokeScale:          1,
+		Background:               "#000000",
+		OutputFileType:           "png",
+		TotalCycles:              10000,
+		Workers:                  1,
+		FrameEvery:               100,
+		FrameDelay:               50,
+		AnimationHold:            2000,
+		Inputs:                   []string{"./input"},
+		Output:                   "./output",
+		NameTemplate:             defaultNameTemplate,
+		OnExists:                 OnExistsIncrement,
+	}
 }
 
 func GetCommand() *cobra.Command {
 	params := &TransformerUserParams{}
+	defaults := DefaultParams()
 	cmd := &cobra.Command{
 		Use:   "transform",
 		Short: "Transform the images in input to output",
-		Run: func(cmd *cobra.Command, args []string) {
-			Run(params)
-			fmt.Printf("Done!\n")
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := Run(cmd.Context(), params); err != nil {
+				return commandError(cmd, reportWriter(params), err)
+			}
+			fmt.Fprintf(reportWriter(params), "Done!\n")
+			return nil
 		},
 	}
-	cmd.Flags().IntVar(&params.DestHeight, "dest-height", 1000, "Height of the destination target; if set to 0, will attempt to use the source height")
-	cmd.Flags().IntVar(&params.DestWidth, "dest-width", 1000, "Width of the destination target; if set to 0, will attempt to use the source width")
-	cmd.Flags().Float64Var(&params.StrokeJitterRatio, "stroke-jitter-ratio", .001, "How much jitter or deviation we add for targets")
-	cmd.Flags().Float64Var(&params.StrokeRatio, "stroke-ratio", .75, "Size of the stroke compared to the final result")
-	cmd.Flags().Float64Var(&params.StrokeReduction, "stroke-reduction", .002, "Reduce the stroke by this amount on each iteration")
-	cmd.Flags().Float64Var(&params.StrokeInversionThreshold, "stroke-inversion-threshold", .05, "Once crossed, we add borders for visibility")
-	cmd.Flags().Float64Var(&params.InitialAlpha, "initial-alpha", .1, "The initial transparency and we build up on each iteration")
-	cmd.Flags().Float64Var(&params.AlphaIncrease, "alpha-increase", .02, "How much alpha to increase by on each iteration")
-	cmd.Flags().IntVar(&params.MinEdgeCount, "min-edges", 3, "The minimum number of edges for each shape")
-	cmd.Flags().IntVar(&params.MaxEdgeCount, "max-edges", 4, "The maximum number of edges for each shape")
-	cmd.Flags().StringVar(&params.OutputFileType, "output-type", "png", "The desired output, either png or jpg; if set incorrectly, will be set to png")
-	cmd.Flags().IntVar(&params.TotalCycles, "cycles", 10000, "The number of iterations to apply the transformation")
+	cmd.Flags().StringArrayVar(&params.Inputs, "input", defaults.Inputs, "An image, directory, or glob to transform, or - to read an image from stdin; repeat to add more")
+	cmd.Flags().StringVar(&params.Output, "output", defaults.Output, "The directory to write to, a file name when there is a single input, or - to write the image to stdout")
+	cmd.Flags().BoolVar(&params.Recursive, "recursive", defaults.Recursive, "Also transform the images in directories below the inputs, mirroring them in the output directory")
+	cmd.Flags().BoolVar(&params.Watch, "watch", defaults.Watch, "Keep running after the inputs are transformed and transform any image added to the input directories; stop with Ctrl-C")
+	cmd.Flags().StringVar(&params.NameTemplate, "name-template", defaults.NameTemplate, "How outputs are named, without the extension; placeholders are {name} for the source, {date}, {seq} for the position of the input in the run, and any flag such as {seed}, {cycles}, or {stroke-ratio}")
+	cmd.Flags().StringVar(&params.OnExists, "on-exists", defaults.OnExists, "What to do when an output already exists; increment adds a number to the name, overwrite replaces it, and skip leaves it and does not transform the input")
+	addSketchFlags(cmd.Flags(), params, defaults)
+	cmd.Flags().StringVar(&params.OutputFileType, "output-type", defaults.OutputFileType, "The desired output, either png, jpg, gif, bmp, tiff, or svg; if set incorrectly, will be set to png")
+	cmd.Flags().StringVar(&params.OutputOptions, "output-options", defaults.OutputOptions, outputOptionsHelp)
+	cmd.Flags().IntVar(&params.Workers, "workers", defaults.Workers, "The number of images to transform in parallel")
+	cmd.Flags().StringVar(&params.AnimationType, "animation", defaults.AnimationType, "If set to gif or apng, also write an animation of the transformation next to the output")
+	cmd.Flags().IntVar(&params.FrameEvery, "frame-every", defaults.FrameEvery, "When animating, capture a frame every this many cycles")
+	cmd.Flags().IntVar(&params.FrameDelay, "frame-delay", defaults.FrameDelay, "When animating, how long each frame is shown in milliseconds")
+	cmd.Flags().IntVar(&params.AnimationLoops, "animation-loops", defaults.AnimationLoops, "When animating, how many times the animation plays; 0 loops forever")
+	cmd.Flags().IntVar(&params.AnimationHold, "animation-hold", defaults.AnimationHold, "When animating, how long the final frame is shown in milliseconds")
+	cmd.Flags().BoolVar(&params.ShapeLog, "shape-log", defaults.ShapeLog, "Also write every shape that is drawn to a log next to the output, which art render can replay at any size")
+	cmd.Flags().IntVar(&params.CheckpointEvery, "checkpoint-every", defaults.CheckpointEvery, "Save a checkpoint next to the output every this many cycles and at the end of the run; 0 disables checkpoints")
+	cmd.Flags().StringVar(&params.Resume, "resume", defaults.Resume, "Continue the run saved in this checkpoint instead of transforming the inputs; the other flags are taken from the checkpoint")
+	cmd.Flags().IntVar(&params.Extend, "extend", defaults.Extend, "When resuming, add this many cycles to the run, which also continues a run that already finished")
 	return cmd
 }
 
-// Run is the entry point and where config options will be passed when implemented
-func Run(originalParams *TransformerUserParams) {
-	rand.Seed(time.Now().Unix())
+// commandError prints an error from a command the way the commands always have and hands it back to cobra,
+// so the process exits with a failure status without the error being printed twice or the usage shown
+func commandError(cmd *cobra.Command, out io.Writer, err error) error {
+	fmt.Fprintf(out, "ERROR: %v\n", err)
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+	return err
+}
 
-	files, err := ioutil.ReadDir("./input")
+// Run is the entry point and where config options will be passed when implemented. Cancelling the context
+// stops the run, saving whatever has been painted so far
+func Run(ctx context.Context, originalParams *TransformerUserParams) error {
+	out := reportWriter(originalParams)
+	if originalParams.Resume != "" {
+		return resume(ctx, originalParams, out)
+	}
+	if originalParams.Extend != 0 {
+		return errors.New("extend can only be used with resume")
+	}
+	if originalParams.Seed == 0 {
+		originalParams.Seed = newSeed()
+	}
+	fmt.Fprintf(out, "Using seed %d\n", originalParams.Seed)
+
+	sources, skipped, err := findSources(originalParams.Inputs, originalParams.Recursive)
 	if err != nil {
-		log.Panicln(err)
+		return err
+	}
+	reportSkipped(out, skipped)
+	if len(sources) == 0 && !originalParams.Watch {
+		fmt.Fprintf(out, "No images found in %s\n", strings.Join(originalParams.Inputs, ", "))
+		return nil
+	}
+	destination, err := findDestination(originalParams.Output, sources)
+	if err != nil {
+		return err
+	}
+	if originalParams.Watch {
+		if err := validateWatch(originalParams, destination); err != nil {
+			return err
+		}
+	}
+	for _, source := range sources {
+		if source.path == stdio && originalParams.CheckpointEvery > 0 {
+			return errors.New("checkpoints cannot be used when reading from stdin, since the run could not be resumed without the source")
+		}
 	}
 
+	// an output file is written in the type of its extension
+	if extension := strings.TrimPrefix(filepath.Ext(destination.file), "."); extension != "" {
+		if _, err := imageutils.GetImageFormatFromString(extension); err == nil {
+			originalParams.OutputFileType = extension
+		}
+	}
 	format, err := imageutils.GetImageFormatFromString(originalParams.OutputFileType)
 	if err != nil {
 		format = imageutils.ImageFormatPNG
 	}
 
+	config, err := newSketchConfig(originalParams, format)
+	if err != nil {
+		return err
+	}
+
+	template, err := parseNameTemplate(originalParams.NameTemplate)
+	if err != nil {
+		return err
+	}
+	if err := validateOnExists(originalParams.OnExists); err != nil {
+		return err
+	}
+
+	animation, err := imageutils.GetAnimationFormatFromString(originalParams.AnimationType)
+	if err != nil {
+		fmt.Fprintf(out, "Unknown animation type %s; animations will not be written\n", originalParams.AnimationType)
+	}
+
+	// inputs are numbered for the name template in the order they are found, and watched inputs carry on
+	// from there
+	seq := 0
+	claimed := map[string]bool{}
+	newJob := func(source source, now string) (transformJob, bool) {
+		seq++
+		outputDir := filepath.Join(destination.dir, source.subdir)
+		outputName := destination.file
+		if outputName == "" {
+			outputName = template.execute(source.name, now, seq, originalParams)
+		}
+		if !destination.stdout {
+			var ok bool
+			if outputName, ok = claimOutput(outputDir, outputName, originalParams.OnExists, claimed); !ok {
+				fmt.Fprintf(out, "%s: skipped, since %s already exists\n", source.name, filepath.Join(outputDir, outputName))
+				return transformJob{}, false
+			}
+		}
+		return transformJob{
+			inputName:      source.name,
+			inputPath:      source.path,
+			outputDir:      outputDir,
+			outputName:     outputName,
+			stdout:         destination.stdout,
+			checkpointPath: filepath.Join(outputDir, strings.TrimSuffix(outputName, filepath.Ext(outputName))+checkpointExtension),
+			cycles:         originalParams.TotalCycles,
+			format:         format,
+			animation:      animation,
+			config:         config,
+		}, true
+	}
+	if originalParams.Watch {
+		return watch(ctx, originalParams, sources, destination, newJob, out)
+	}
+
 	now := time.Now().Format("2006-01-02T15:04:05")
+	jobs := []transformJob{}
+	for _, source := range sources {
+		if job, ok := newJob(source, now); ok {
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	_, err = runJobs(ctx, jobs, originalParams, out)
+	return err
+}
 
-	for i := range files {
-		fileName := files[i].Name()
+// resume continues the run saved in a checkpoint, adding any extra cycles that were asked for. The output is
+// written next to the checkpoint
+func resume(ctx context.Context, originalParams *TransformerUserParams, out io.Writer) error {
+	cp, err := loadCheckpoint(originalParams.Resume)
+	if err != nil {
+		return err
+	}
+	params := &cp.Params
+	params.TotalCycles += originalParams.Extend
+	cp.Original.TotalCycles += originalParams.Extend
+	if cp.Cycle >= params.TotalCycles {
+		fmt.Fprintf(out, "The checkpoint already finished all %d cycles; use extend to add more\n", params.TotalCycles)
+		return nil
+	}
+	fmt.Fprintf(out, "Resuming %s at cycle %d of %d with seed %d\n", cp.InputName, cp.Cycle, params.TotalCycles, params.Seed)
 
-		// we want to copy from the original, since we use the struct as state
-		// in subsequent calls
-		params := &TransformerUserParams{}
-		copier.Copy(params, originalParams)
+	format, err := imageutils.GetImageFormatFromString(params.OutputFileType)
+	if err != nil {
+		format = imageutils.ImageFormatPNG
+	}
+	config, err := newSketchConfig(params, format)
+	if err != nil {
+		return err
+	}
+	animation, _ := imageutils.GetAnimationFormatFromString(params.AnimationType)
+	template, err := parseNameTemplate(params.NameTemplate)
+	if err != nil {
+		return err
+	}
+	outputDir := filepath.Dir(originalParams.Resume)
+	outputName, ok := claimOutput(outputDir, template.execute(cp.InputName, time.Now().Format("2006-01-02T15:04:05"), 1, params), params.OnExists, map[string]bool{})
+	if !ok {
+		fmt.Fprintf(out, "%s: skipped, since %s already exists\n", cp.InputName, filepath.Join(outputDir, outputName))
+		return nil
+	}
 
-		// split on the name to identify the file type
-		parts := strings.Split(fileName, ".")
-		if len(parts) < 2 {
-			continue // not a valid file type
+	_, err = runJobs(ctx, []transformJob{{
+		inputName:      cp.InputName,
+		inputPath:      cp.InputPath,
+		outputDir:      outputDir,
+		outputName:     outputName,
+		checkpointPath: originalParams.Resume,
+		resume:         cp,
+		cycles:         params.TotalCycles - cp.Cycle,
+		format:         format,
+		animation:      animation,
+		config:         config,
+	}}, params, out)
+	return err
+}
+
+// runJobs transforms each job on a pool of workers and reports how they went. Once the context is cancelled,
+// no new jobs are started and the running ones are saved as they are. The error says how many jobs failed or
+// were stopped, after each of them has been reported
+func runJobs(ctx context.Context, jobs []transformJob, originalParams *TransformerUserParams, out io.Writer) ([]transformResult, error) {
+	workers := originalParams.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	totalCycles := 0
+	for i := range jobs {
+		totalCycles += jobs[i].cycles
+	}
+	bar := progressbar.NewMultiBar(&progressbar.BarOptions{
+		Max:          totalCycles,
+		Width:        50,
+		EnableColors: true,
+		Description:  "Transforming",
+		Writer:       out,
+	}, len(jobs))
+
+	queue := make(chan transformJob)
+	results := make([]transformResult, len(jobs))
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if ctx.Err() != nil {
+					continue
+				}
+				bar.Start(job.inputName)
+				results[job.index] = transformFile(ctx, job, originalParams, bar)
+				if results[job.index].partial {
+					bar.Abandon(job.inputName)
+				} else {
+					bar.Finish(job.inputName)
+				}
+			}
+		}()
+	}
+queueing:
+	for i := range jobs {
+		jobs[i].index = i
+		select {
+		case queue <- jobs[i]:
+		case <-ctx.Done():
+			break queueing
+		}
+	}
+	close(queue)
+	wg.Wait()
+	cancelled := ctx.Err() != nil
+	if cancelled {
+		bar.Stop()
+	} else {
+		bar.Close()
+	}
+	fmt.Fprintf(out, "\n")
+
+	completed, failed := 0, 0
+	for i := range jobs {
+		switch {
+		case results[i].err != nil:
+			failed++
+			fmt.Fprintf(out, "%s: %+v\n", jobs[i].inputName, results[i].err)
+		case results[i].outputPath == "":
+			fmt.Fprintf(out, "%s: not started\n", jobs[i].inputName)
+		case results[i].partial:
+			fmt.Fprintf(out, "%s: stopped early; the partial output was saved to %s\n", jobs[i].inputName, results[i].outputPath)
+		default:
+			completed++
+			if cancelled {
+				fmt.Fprintf(out, "%s: completed\n", jobs[i].inputName)
+			}
 		}
-		extension := parts[len(parts)-1]
-		if extension != "jpg" && extension != "jpeg" && extension != "png" {
-			continue
+		if results[i].err == nil && results[i].outputPath != "" && originalParams.Mode == ModeClimb {
+			fmt.Fprintf(out, "%s: %.2f%% similar to the source\n", jobs[i].inputName, results[i].similarity*100)
 		}
-		outputName := fmt.Sprintf("%s_%s_%dcycles_transformed.%s", strings.TrimSuffix(fileName, filepath.Ext(fileName)), now, params.TotalCycles, params.OutputFileType)
+	}
+	if cancelled {
+		return results, fmt.Errorf("stopped early; %d of %d files were completed", completed, len(jobs))
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d files could not be transformed", failed, len(jobs))
+	}
+	return results, nil
+}
 
-		// now handle the file
-		img, err := imageutils.LoadImage("./input/" + fileName)
-		if err != nil {
-			log.Panicln(err)
+// addSketchFlags registers the flags that shape how a sketch is drawn, which are shared by the commands that
+// transform images
+func addSketchFlags(flags *pflag.FlagSet, params *TransformerUserParams, defaults TransformerUserParams) {
+	flags.IntVar(&params.DestHeight, "dest-height", defaults.DestHeight, "Height of the destination target; if set to 0, will attempt to use the source height or keep the source aspect ratio")
+	flags.IntVar(&params.DestWidth, "dest-width", defaults.DestWidth, "Width of the destination target; if set to 0, will attempt to use the source width or keep the source aspect ratio")
+	flags.StringVar(&params.ResizeMode, "resize-mode", defaults.ResizeMode, "How the source is mapped onto the destination size; fit keeps the aspect ratio inside the size, fill trims the center of the source to the size, crop trims to the most detailed region, and stretch scales each side independently")
+	flags.Float64Var(&params.Scale, "scale", defaults.Scale, "Multiply the destination size by this amount")
+	flags.StringVar(&params.SizePreset, "size-preset", defaults.SizePreset, fmt.Sprintf("A named destination size that replaces the width and height; one of %s", strings.Join(SizePresetNames(), ", ")))
+	flags.Float64Var(&params.StrokeJitterRatio, "stroke-jitter-ratio", defaults.StrokeJitterRatio, "How much jitter or deviation we add for targets")
+	flags.Float64Var(&params.StrokeRatio, "stroke-ratio", defaults.StrokeRatio, "Size of the stroke compared to the final result")
+	flags.Float64Var(&params.StrokeReduction, "stroke-reduction", defaults.StrokeReduction, "Reduce the stroke by this amount on each iteration")
+	flags.Float64Var(&params.StrokeInversionThreshold, "stroke-inversion-threshold", defaults.StrokeInversionThreshold, "Once crossed, we add borders for visibility")
+	flags.Float64Var(&params.InitialAlpha, "initial-alpha", defaults.InitialAlpha, "The initial transparency and we build up on each iteration")
+	flags.Float64Var(&params.AlphaIncrease, "alpha-increase", defaults.AlphaIncrease, "How much alpha to increase by on each iteration")
+	flags.IntVar(&params.MinEdgeCount, "min-edges", defaults.MinEdgeCount, "The minimum number of edges for each shape")
+	flags.IntVar(&params.MaxEdgeCount, "max-edges", defaults.MaxEdgeCount, "The maximum number of edges for each shape")
+	flags.StringVar(&params.Shapes, "shapes", defaults.Shapes, fmt.Sprintf("The shapes to draw with optional weights, such as circle:3,polygon:1; available shapes are %s", strings.Join(ShapeNames(), ", ")))
+	flags.StringVar(&params.Glyphs, "glyphs", defaults.Glyphs, "The characters to choose from when drawing the glyph shape")
+	flags.StringVar(&params.Mode, "mode", defaults.Mode, "Either paint, which draws every shape, or climb, which only draws shapes that bring the canvas closer to the source")
+	flags.StringVar(&params.Sampling, "sampling", defaults.Sampling, fmt.Sprintf("Where shapes are placed; one of %s", strings.Join(samplingStrategies, ", ")))
+	flags.StringVar(&params.Orientation, "orientation", defaults.Orientation, "How shapes are rotated; random, gradient to follow the edges of the source, or structure to follow its smoothed contours")
+	flags.Float64Var(&params.Elongation, "elongation", defaults.Elongation, "Stretch each shape along its rotation by this ratio of length to width, such as 3 for brush strokes; 1 leaves shapes as they are")
+	flags.IntVar(&params.ClimbSteps, "climb-steps", defaults.ClimbSteps, "In climb mode, how many mutations of each shape to try before committing the best one")
+	flags.StringVar(&params.StrokeSchedule, "stroke-schedule", defaults.StrokeSchedule, "A schedule for the stroke size over the run, as fractions of the initial size, such as exp:1,0.02; replaces stroke-reduction")
+	flags.StringVar(&params.AlphaSchedule, "alpha-schedule", defaults.AlphaSchedule, "A schedule for the alpha over the run, from 0 to 255, such as linear:10,200; replaces initial-alpha and alpha-increase")
+	flags.StringVar(&params.JitterSchedule, "jitter-schedule", defaults.JitterSchedule, "A schedule for the jitter over the run, as multiples of stroke-jitter-ratio, such as cosine:4,1")
+	flags.StringVar(&params.Mask, "mask", defaults.Mask, "A grayscale image that steers every input; white areas are painted in detail, darker areas get fewer shapes, and black areas are not painted")
+	flags.StringVar(&params.MaskDir, "mask-dir", defaults.MaskDir, "A directory of masks named after each input, such as mask-dir/photo.png for input/photo.jpg; these take priority over mask")
+	flags.Float64Var(&params.MaskStrokeScale, "mask-stroke-scale", defaults.MaskStrokeScale, "How many times larger strokes are in the black areas of a mask compared to the white areas")
+	flags.StringVar(&params.Background, "background", defaults.Background, "The canvas background; a hex color, transparent (png, tiff, or svg only), source, blur, desaturate, or average")
+	flags.IntVar(&params.TotalCycles, "cycles", defaults.TotalCycles, "The number of iterations to apply the transformation")
+	flags.Int64Var(&params.Seed, "seed", defaults.Seed, "The seed for the random generator; if set to 0, a seed will be chosen and printed so the run can be reproduced")
+}
+
+// newSketchConfig validates the params and parses the values that are shared by every sketch in the run
+func newSketchConfig(params *TransformerUserParams, format imageutils.ImageFormat) (*sketchConfig, error) {
+	config := &sketchConfig{}
+	var err error
+	if config.shapes, err = parseShapes(params.Shapes); err != nil {
+		return nil, err
+	}
+	if params.Mode != ModePaint && params.Mode != ModeClimb {
+		return nil, fmt.Errorf("invalid mode %s; it must be %s or %s", params.Mode, ModePaint, ModeClimb)
+	}
+	if err := validateSampling(params.Sampling); err != nil {
+		return nil, err
+	}
+	if err := validateOrientation(params); err != nil {
+		return nil, err
+	}
+	if err := validateSizing(params); err != nil {
+		return nil, err
+	}
+	if err := validateBackground(params.Background, format); err != nil {
+		return nil, err
+	}
+	if config.encoding, err = imageutils.ParseEncodeOptions(params.OutputOptions); err != nil {
+		return nil, err
+	}
+	if config.strokeSchedule, err = parseSchedule(params.StrokeSchedule); err != nil {
+		return nil, fmt.Errorf("stroke schedule: %w", err)
+	}
+	if config.alphaSchedule, err = parseSchedule(params.AlphaSchedule); err != nil {
+		return nil, fmt.Errorf("alpha schedule: %w", err)
+	}
+	if config.jitterSchedule, err = parseSchedule(params.JitterSchedule); err != nil {
+		return nil, fmt.Errorf("jitter schedule: %w", err)
+	}
+	for _, path := range []string{params.Mask, params.MaskDir} {
+		if _, err := os.Stat(path); path != "" && err != nil {
+			return nil, fmt.Errorf("could not find the mask: %w", err)
 		}
+	}
+	if params.MaskStrokeScale <= 0 {
+		return nil, fmt.Errorf("invalid mask stroke scale %v; it must be greater than 0", params.MaskStrokeScale)
+	}
+	if params.AnimationLoops < 0 {
+		return nil, fmt.Errorf("invalid animation loops %d; it must be 0 to loop forever or more", params.AnimationLoops)
+	}
+	return config, nil
+}
 
-		sketch := newTransformerSketch(img, params)
-		params.StrokeJitter = int(params.StrokeJitterRatio * float64(params.DestWidth))
+// transformJob is a single file to be processed by one of the workers
+type transformJob struct {
+	index          int
+	inputName      string
+	inputPath      string
+	outputDir      string
+	outputName     string
+	stdout         bool
+	checkpointPath string
+	shapeLogPath   string
+	resume         *checkpoint
+	cycles         int
+	format         imageutils.ImageFormat
+	animation      imageutils.AnimationFormat
+	config         *sketchConfig
+}
 
-		bar := progressbar.GetProgressBar(&progressbar.BarOptions{
-			Max:          params.TotalCycles,
-			Width:        50,
-			EnableColors: true,
-			Description:  fmt.Sprintf("[%d of %d] Transforming %s to %s", i, len(files)-1, fileName, outputName),
-		})
+// transformResult is the outcome of a single job
+type transformResult struct {
+	err        error
+	similarity float64
+	outputPath string
+	partial    bool
+}
 
-		for i := 0; i < params.TotalCycles; i++ {
-			bar.Add(1)
-			sketch.update()
+// transformFile loads, transforms, and saves a single file. Each call builds its own sketch, generator,
+// and canvas so files can be processed in parallel without changing the output
+func transformFile(ctx context.Context, job transformJob, originalParams *TransformerUserParams, bar *progressbar.MultiBar) transformResult {
+	img, hash, err := loadSource(job.inputPath)
+	if err != nil {
+		return transformResult{err: err}
+	}
+	if err := os.MkdirAll(job.outputDir, 0755); err != nil {
+		return transformResult{err: fmt.Errorf("could not create the output directory: %w", err)}
+	}
+
+	// we want to copy from the original, since we use the struct as state
+	// in subsequent calls
+	params := &TransformerUserParams{}
+	started := 0
+	if job.resume != nil {
+		*params = job.resume.Params
+		started = job.resume.Cycle
+	} else {
+		copier.Copy(params, originalParams)
+	}
+	opts := []Option{WithParams(*params)}
+	if path := findMask(job.inputName, params); path != "" {
+		mask, err := imageutils.LoadImage(path)
+		if err != nil {
+			return transformResult{err: err}
 		}
+		opts = append(opts, WithMask(mask))
+	}
 
-		err = imageutils.SaveImage(sketch.output(), format, "./output/"+outputName)
+	var logFile *os.File
+	var logOffset int64
+	if params.ShapeLog {
+		if logFile, job.shapeLogPath, logOffset, err = openShapeLog(job); err != nil {
+			return transformResult{err: err}
+		}
+		defer logFile.Close()
+		opts = append(opts, WithShapeLog(logFile))
+	}
+
+	var anim *imageutils.AnimationWriter
+	if job.animation != imageutils.AnimationFormatNone {
+		anim, err = newAnimation(job, params, img)
 		if err != nil {
-			fmt.Printf("%+v\n", err)
+			return transformResult{err: err}
+		}
+		opts = append(opts, WithFrames(params.FrameEvery, func(frame image.Image, cycle int) error {
+			return anim.AddFrame(frame)
+		}))
+	}
+
+	// report in batches so the workers are not all contending on the bar
+	reported := started
+	opts = append(opts, WithProgress(progressBatchSize, func(p Progress) {
+		bar.Add(p.Cycle - reported)
+		reported = p.Cycle
+	}))
+	opts = append(opts, func(o *options) {
+		o.config = job.config
+		if job.inputPath != stdio {
+			o.sourcePath = job.inputPath
+		}
+		o.resume = job.resume
+		o.shapeLogOffset = logOffset
+		o.checkpoint = func(s *TransformerSketch) error {
+			return saveCheckpoint(job.checkpointPath, s, job)
+		}
+	})
+
+	// a cancelled run still keeps everything painted so far
+	sketch, err := runTransform(ctx, img, opts...)
+	partial := sketch != nil && sketch.cycle < sketch.TotalCycles
+	if err != nil && !(partial && errors.Is(err, ctx.Err())) {
+		if anim != nil {
+			anim.Close()
+		}
+		return transformResult{err: err}
+	}
+
+	// the final checkpoint is what lets a finished run be extended later, or a cancelled run be resumed
+	if sketch.CheckpointEvery > 0 || job.resume != nil {
+		if err := saveCheckpoint(job.checkpointPath, sketch, job); err != nil {
+			if anim != nil {
+				anim.Close()
+			}
+			return transformResult{err: err}
+		}
+	}
+
+	if anim != nil {
+		if err := anim.Close(); err != nil {
+			return transformResult{err: err}
+		}
+	}
+
+	if logFile != nil {
+		if err := logFile.Close(); err != nil {
+			return transformResult{err: fmt.Errorf("could not write the shape log: %w", err)}
+		}
+	}
+
+	metadata := newMetadata(sketch)
+	metadata[MetadataCommand] = commandLine()
+	metadata[MetadataSource] = job.inputPath
+	metadata[MetadataSourceSHA256] = hash
+	result := transformResult{outputPath: "stdout", partial: partial}
+	if sketch.climb != nil {
+		result.similarity = similarity(sketch.dc.Image().(*image.RGBA), sketch.climb.target)
+	}
+	if job.stdout {
+		if sketch.vector != nil {
+			_, result.err = sketch.vector.WriteTo(os.Stdout)
+		} else {
+			result.err = imageutils.EncodeImage(os.Stdout, sketch.output(), job.format, metadata, job.config.encoding)
 		}
 		sketch.dc.Clear()
-		bar.Close()
-		fmt.Printf("\n")
+		return result
+	}
+	name := job.outputName
+	if partial {
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + "_partial" + filepath.Ext(name)
+	}
+	result.outputPath = filepath.Join(job.outputDir, name)
+	if sketch.vector != nil {
+		result.err = sketch.vector.Save(result.outputPath)
+	} else {
+		result.err = imageutils.SaveImage(sketch.output(), job.format, result.outputPath, metadata, job.config.encoding)
 	}
+	sketch.dc.Clear()
+	return result
+}
 
+// newAnimation creates the writer for the animation that is saved next to the still output
+func newAnimation(job transformJob, params *TransformerUserParams, source image.Image) (*imageutils.AnimationWriter, error) {
+	options := &imageutils.AnimationOptions{
+		Format: job.animation,
+		Delay:  params.FrameDelay,
+		Hold:   params.AnimationHold,
+		Loops:  params.AnimationLoops,
+	}
+	if job.animation == imageutils.AnimationFormatGIF {
+		// leave room for a solid background so gaps between shapes stay true to the still
+		options.Palette = imageutils.PaletteFromImage(source, 256)
+		if background := backgroundColor(source, params.Background); background != nil {
+			options.Palette = append(imageutils.PaletteFromImage(source, 255), background)
+		}
+	}
+	name := strings.TrimSuffix(job.outputName, filepath.Ext(job.outputName)) + "_animated." + job.animation.Extension()
+	return imageutils.NewAnimationWriter(filepath.Join(job.outputDir, name), options)
 }
 
-// newTransformerSketch creates a new transforming sketch to generate art based upon a source image
-func newTransformerSketch(source image.Image, userParams *TransformerUserParams) *TransformerSketch {
-	s := &TransformerSketch{TransformerUserParams: userParams}
+// newTransformerSketch creates a new transforming sketch to generate art based upon a source image and an
+// optional mask
+func newTransformerSketch(source image.Image, mask *weightMap, userParams *TransformerUserParams, config *sketchConfig) *TransformerSketch {
+	crop, width, height := fitCanvas(source, userParams)
+	return buildSketch(source, mask, crop, width, height, userParams, config)
+}
+
+// buildSketch creates a sketch for a region of the source and a canvas size that have already been worked out
+func buildSketch(source image.Image, mask *weightMap, crop image.Rectangle, width, height int, userParams *TransformerUserParams, config *sketchConfig) *TransformerSketch {
+	s := &TransformerSketch{TransformerUserParams: userParams, sketchConfig: config, original: *userParams}
+	s.crop = crop
+	s.DestWidth, s.DestHeight = width, height
+	source = cropImage(source, crop)
+	if mask != nil {
+		s.mask = mask.crop(crop)
+	}
 	bounds := source.Bounds()
 	s.sourceWidth, s.sourceHeight = bounds.Max.X, bounds.Max.Y
-	if s.DestHeight == 0 {
-		s.DestHeight = s.sourceHeight
-	}
-	if s.DestWidth == 0 {
-		s.DestWidth = s.sourceWidth
-	}
+
+	// each sketch gets its own generator so the same seed always produces the same output
+	s.pcg, s.rng = newPCG(s.Seed)
 
 	s.initialStrokeSize = s.StrokeRatio * float64(s.DestWidth)
 	s.strokeSize = s.initialStrokeSize
+	s.initialJitter = s.StrokeJitterRatio * float64(s.DestWidth)
+	s.StrokeJitter = int(s.initialJitter)
+	s.scheduleCycles = s.TotalCycles
 
-	canvas := gg.NewContext(s.DestWidth, s.DestHeight)
-	canvas.SetColor(color.Black)
-	canvas.DrawRectangle(0, 0, float64(s.DestWidth), float64(s.DestHeight))
-	canvas.FillPreserve()
+	dc := gg.NewContext(s.DestWidth, s.DestHeight)
+	paintBackground(dc, source, s.Background)
 
 	s.source = source
-	s.dc = canvas
+	s.dc = dc
+	s.drawing = dc
+	if format, _ := imageutils.GetImageFormatFromString(s.OutputFileType); format == imageutils.ImageFormatSVG {
+		// the raster canvas is still drawn for scoring, animations, and checkpoints, and the vector canvas
+		// records the same calls
+		s.vector = canvas.NewSVG(s.DestWidth, s.DestHeight)
+		paintVectorBackground(s.vector, dc, source, s.Background)
+		s.drawing = canvas.Tee(dc, s.vector)
+	}
+	var clip *image.Alpha
+	if s.mask != nil {
+		// the background is already painted, so the mask only keeps the shapes out of the black areas
+		clip = s.mask.clip(s.DestWidth, s.DestHeight)
+		dc.SetMask(clip)
+		if s.vector != nil {
+			s.vector.SetMask(clip)
+		}
+	}
+	s.sampler = newSampler(s.Sampling, source, s.scheduleCycles, s.mask)
+	s.orientation = newOrientationField(source, s.Orientation)
+	if s.Mode == ModeClimb {
+		s.climb = newClimber(source, s.DestWidth, s.DestHeight, s.ClimbSteps, clip)
+	}
 	return s
 }
 
 // update draws on each cycle of the algorithm
 func (s *TransformerSketch) update() {
+	s.applySchedules()
+	shape, r, g, b := s.nextShape()
+	if shape != nil && s.climb != nil {
+		shape, r, g, b = s.climb.improve(s, shape, r, g, b)
+	}
+	if shape != nil {
+		s.drawShape(s.drawing, shape, r, g, b)
+		if s.shapeLog != nil {
+			fill, outline := s.shapeColors(r, g, b)
+			s.shapeLog.add(shape, fill, outline)
+		}
+	}
+
+	// the per cycle flags only apply when there is no schedule for that value
+	if s.strokeSchedule == nil {
+		s.strokeSize -= s.StrokeReduction * s.strokeSize
+	}
+	if s.alphaSchedule == nil {
+		s.InitialAlpha += s.AlphaIncrease
+	}
+	s.cycle++
+}
+
+// applySchedules sets the stroke size, alpha, and jitter for the current cycle from any schedules
+func (s *TransformerSketch) applySchedules() {
+	// schedules stay on the length of the original run, so extending a run holds their final values
+	progress := 0.0
+	if s.scheduleCycles > 1 {
+		progress = float64(s.cycle) / float64(s.scheduleCycles-1)
+	}
+	if s.strokeSchedule != nil {
+		s.strokeSize = s.initialStrokeSize * s.strokeSchedule.at(progress)
+	}
+	if s.alphaSchedule != nil {
+		s.InitialAlpha = s.alphaSchedule.at(progress)
+	}
+	if s.jitterSchedule != nil {
+		s.StrokeJitter = int(s.initialJitter * s.jitterSchedule.at(progress))
+	}
+}
+
+// nextShape picks a random location and creates a shape there, colored from the source. It returns a nil
+// shape if the location is masked out
+func (s *TransformerSketch) nextShape() (Shape, int, int, int) {
 	// get the color info
-	rndX := rand.Float64() * float64(s.sourceWidth)
-	rndY := rand.Float64() * float64(s.sourceHeight)
+	rndX, rndY := s.sampler.next(s.rng, s.strokeSize*float64(s.sourceWidth)/float64(s.DestWidth))
 	r, g, b := rgb255(s.source.At(int(rndX), int(rndY)))
 
+	size := s.strokeSize
+	if s.mask != nil {
+		if s.mask.at(rndX, rndY) == 0 {
+			return nil, 0, 0, 0
+		}
+		size *= s.mask.strokeMultiplier(rndX, rndY, s.MaskStrokeScale)
+	}
+
 	// determine the output
 	destX := rndX * float64(s.DestWidth) / float64(s.sourceWidth)
-	destX += float64(randRange(s.StrokeJitter))
+	destX += float64(s.randRange(s.StrokeJitter))
 	destY := rndY * float64(s.DestHeight) / float64(s.sourceHeight)
-	destY += float64(randRange(s.StrokeJitter))
-
-	// draw the stroke
-	edges := s.MinEdgeCount + rand.Intn(s.MaxEdgeCount-s.MinEdgeCount+1)
+	destY += float64(s.randRange(s.StrokeJitter))
+
+	rotation := s.rng.ExpFloat64()
+	if s.orientation != nil {
+		if angle, ok := s.orientation.at(rndX, rndY); ok {
+			// the canvas may be scaled differently on each axis, which bends the angle
+			sin, cos := math.Sincos(angle)
+			rotation = math.Atan2(sin*float64(s.DestHeight)/float64(s.sourceHeight), cos*float64(s.DestWidth)/float64(s.sourceWidth))
+		}
+	}
+	shape := s.shapes.pick(s.rng)(s.rng, s.TransformerUserParams, destX, destY, size, rotation)
+	return stretch(shape, destX, destY, rotation, s.Elongation), r, g, b
+}
 
-	s.dc.SetRGBA255(r, g, b, int(s.InitialAlpha))
-	s.dc.DrawRegularPolygon(edges, destX, destY, s.strokeSize, rand.ExpFloat64())
-	s.dc.FillPreserve()
+// drawShape paints the shape onto the context with the current alpha
+func (s *TransformerSketch) drawShape(dc canvas.Canvas, shape Shape, r, g, b int) {
+	fill, outline := s.shapeColors(r, g, b)
+	paintShape(dc, shape, fill, outline, 1)
+}
 
+// shapeColors returns the fill and outline for a shape of the color r, g, b, contrasting the outline once the
+// shapes are small enough
+func (s *TransformerSketch) shapeColors(r, g, b int) (color.NRGBA, color.NRGBA) {
+	fill := color.NRGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: s.alpha(s.InitialAlpha)}
+	outline := fill
 	if s.strokeSize <= s.StrokeInversionThreshold*s.initialStrokeSize {
 		if (r+g+b)/3 < 128 {
-			s.dc.SetRGBA255(255, 255, 255, int(s.InitialAlpha*2))
+			outline = color.NRGBA{R: 255, G: 255, B: 255, A: s.alpha(s.InitialAlpha * 2)}
 		} else {
-			s.dc.SetRGBA255(0, 0, 0, int(s.InitialAlpha*2))
+			outline = color.NRGBA{A: s.alpha(s.InitialAlpha * 2)}
 		}
 	}
-	s.dc.Stroke()
+	return fill, outline
+}
 
-	s.strokeSize -= s.StrokeReduction * s.strokeSize
-	s.InitialAlpha += s.AlphaIncrease
+// paintShape fills and outlines a shape; lineScale multiplies the width of every stroke, which keeps the look
+// the same when a shape log is replayed at another size
+func paintShape(dc canvas.Canvas, shape Shape, fill, outline color.NRGBA, lineScale float64) {
+	dc.SetRGBA255(int(fill.R), int(fill.G), int(fill.B), int(fill.A))
+	shape.Path(dc)
+	if width := shape.BrushWidth(); width > 0 {
+		// brush strokes have no area to fill, so they are painted with the stroke itself
+		dc.SetLineWidth(width * lineScale)
+		dc.Stroke()
+	} else {
+		dc.FillPreserve()
+		dc.SetRGBA255(int(outline.R), int(outline.G), int(outline.B), int(outline.A))
+		dc.SetLineWidth(lineScale)
+		dc.Stroke()
+	}
+	dc.SetLineWidth(1)
+}
 
+// colorAt samples the source at a point on the canvas
+func (s *TransformerSketch) colorAt(destX, destY float64) (int, int, int) {
+	x := int(destX * float64(s.sourceWidth) / float64(s.DestWidth))
+	y := int(destY * float64(s.sourceHeight) / float64(s.DestHeight))
+	x = max(0, min(x, s.sourceWidth-1))
+	y = max(0, min(y, s.sourceHeight-1))
+	return rgb255(s.source.At(x, y))
 }
 
 // output generates the output of the transformation
@@ -207,6 +909,28 @@ func rgb255(c color.Color) (r, g, b int) {
 	return int(r0 / 255), int(g0 / 255), int(b0 / 255)
 }
 
-func randRange(max int) int {
-	return -max + rand.Intn(2*max)
+// alpha converts an alpha for drawing. Without an alpha schedule it wraps past 255 the way it always has,
+// which long runs with --alpha-increase depend on for their look, and a schedule is kept within 0 to 255
+func (s *TransformerSketch) alpha(value float64) uint8 {
+	if s.alphaSchedule == nil {
+		return uint8(int(value))
+	}
+	return uint8(max(0, min(255, int(value))))
+}
+
+// randRange returns a value in [-max, max) from the sketch's generator
+func (s *TransformerSketch) randRange(max int) int {
+	if max <= 0 {
+		return 0
+	}
+	return -max + s.rng.IntN(2*max)
+}
+
+// newSeed picks a seed when the user did not supply one
+func newSeed() int64 {
+	seed := time.Now().UnixNano()
+	if seed == 0 {
+		seed = 1
+	}
+	return seed
 }
@@ -0,0 +1,294 @@
+package transformer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettle is how long a new file must go without changing before it is transformed, so files that are
+// still being copied in are not picked up half written
+const watchSettle = 2 * time.Second
+
+// watchRecordName is the file in the output directory that remembers which inputs were already transformed
+const watchRecordName = ".art-watch.json"
+
+// watchRecord remembers the inputs that have been transformed so a restarted watch does not redo them
+type watchRecord struct {
+	path  string
+	Files map[string]watchedFile
+}
+
+// watchedFile is an input as it was when it was transformed; if it changes, it is transformed again
+type watchedFile struct {
+	Size    int64
+	ModTime time.Time
+	Output  string
+}
+
+// validateWatch checks that the inputs are directories that can be watched and that the outputs go to a
+// directory that can hold the record
+func validateWatch(params *TransformerUserParams, destination destination) error {
+	if destination.file != "" || destination.stdout {
+		return errors.New("watch needs an output directory")
+	}
+	for _, input := range params.Inputs {
+		info, err := os.Stat(input)
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("watch needs the inputs to be directories, but %s is not", input)
+		}
+	}
+	return nil
+}
+
+// watch transforms the existing inputs and then any image added to the input directories, until the context
+// is cancelled. Only problems setting up the watch are returned; a file that fails is reported and the watch
+// carries on
+func watch(ctx context.Context, params *TransformerUserParams, sources []source, destination destination, newJob func(source source, now string) (transformJob, bool), out io.Writer) error {
+	record, err := loadWatchRecord(filepath.Join(destination.dir, watchRecordName))
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("could not watch the inputs: %w", err)
+	}
+	defer watcher.Close()
+	for _, input := range params.Inputs {
+		if err := watchDirectory(watcher, input, params.Recursive); err != nil {
+			return err
+		}
+	}
+	outputDir, _ := filepath.Abs(destination.dir)
+
+	transform := func(sources []source) {
+		pending := []transformJob{}
+		now := time.Now().Format("2006-01-02T15:04:05")
+		for _, source := range sources {
+			if record.done(source.path) {
+				continue
+			}
+			if job, ok := newJob(source, now); ok {
+				pending = append(pending, job)
+			}
+		}
+		if len(pending) == 0 {
+			return
+		}
+		// failures were already reported for each file, and the watch keeps going
+		results, _ := runJobs(ctx, pending, params, out)
+		for i, result := range results {
+			if result.err != nil || result.partial || result.outputPath == "" {
+				continue
+			}
+			if err := record.add(pending[i].inputPath, result.outputPath); err != nil {
+				fmt.Fprintf(out, "ERROR: %v\n", err)
+			}
+		}
+	}
+
+	// whatever is already there is done first, skipping anything from an earlier watch
+	transform(sources)
+	if ctx.Err() != nil {
+		return nil
+	}
+	fmt.Fprintf(out, "Watching %s for new images; press Ctrl-C to stop\n", strings.Join(params.Inputs, ", "))
+
+	// each file waits until it has gone quiet for watchSettle, which is reset by every write
+	settling := map[string]time.Time{}
+	ticker := time.NewTicker(watchSettle / 4)
+	defer ticker.Stop()
+
+	// batches run in the background so events keep being read during long transforms; files that settle in
+	// the meantime are queued for the next batch
+	queued := []source{}
+	running := false
+	finished := make(chan struct{})
+	next := func() {
+		if running || len(queued) == 0 {
+			return
+		}
+		batch := queued
+		queued = []source{}
+		running = true
+		go func() {
+			transform(batch)
+			finished <- struct{}{}
+		}()
+	}
+	// a cancelled batch saves what it painted before the watch returns
+	defer func() {
+		if running {
+			<-finished
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-finished:
+			running = false
+			next()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(out, "ERROR: %v\n", err)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if abs, _ := filepath.Abs(event.Name); strings.HasPrefix(abs, outputDir+string(filepath.Separator)) {
+				continue
+			}
+			switch {
+			case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+				delete(settling, event.Name)
+			case event.Has(fsnotify.Create) || event.Has(fsnotify.Write):
+				info, err := os.Stat(event.Name)
+				if err != nil {
+					continue
+				}
+				if !info.IsDir() {
+					// a file that is still being written may not be recognizable yet, so it is only checked once it
+					// has settled
+					if !isHidden(event.Name) {
+						settling[event.Name] = time.Now()
+					}
+					continue
+				}
+				if !params.Recursive {
+					continue
+				}
+				// a directory that was moved in may already hold images, which will not send their own events
+				if err := watchDirectory(watcher, event.Name, true); err != nil {
+					fmt.Fprintf(out, "ERROR: %v\n", err)
+				}
+				found, notImages, _ := findInDirectory(event.Name, true)
+				for _, source := range found {
+					settling[source.path] = time.Now()
+				}
+				reportSkipped(out, notImages)
+			}
+		case <-ticker.C:
+			ready := []source{}
+			for path, changed := range settling {
+				if time.Since(changed) < watchSettle {
+					continue
+				}
+				delete(settling, path)
+				if !isSourceImage(path) {
+					if _, err := os.Stat(path); err == nil {
+						reportSkipped(out, []string{path})
+					}
+					continue
+				}
+				if !slices.ContainsFunc(queued, func(s source) bool { return s.path == path }) {
+					ready = append(ready, watchedSource(path, params.Inputs))
+				}
+			}
+			sort.Slice(ready, func(i, j int) bool { return ready[i].path < ready[j].path })
+			queued = append(queued, ready...)
+			next()
+		}
+	}
+}
+
+// watchDirectory adds a directory to the watcher, along with every directory below it when recursive
+func watchDirectory(watcher *fsnotify.Watcher, dir string, recursive bool) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if !recursive && path != dir {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("could not watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// watchedSource works out which input directory a new file is in, so its place below it is mirrored in the
+// output like it would be for a file that was there from the start
+func watchedSource(path string, inputs []string) source {
+	s := source{path: path, name: filepath.Base(path)}
+	for _, input := range inputs {
+		subdir, err := filepath.Rel(input, filepath.Dir(path))
+		if err == nil && subdir != ".." && !strings.HasPrefix(subdir, ".."+string(filepath.Separator)) {
+			s.subdir = subdir
+			return s
+		}
+	}
+	return s
+}
+
+// loadWatchRecord reads the record from an earlier watch, or starts a new one
+func loadWatchRecord(path string) (*watchRecord, error) {
+	record := &watchRecord{path: path, Files: map[string]watchedFile{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return record, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load the watch record: %w", err)
+	}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("could not read the watch record %s: %w", path, err)
+	}
+	if record.Files == nil {
+		record.Files = map[string]watchedFile{}
+	}
+	return record, nil
+}
+
+// done checks whether an input was already transformed and has not changed since
+func (r *watchRecord) done(path string) bool {
+	key, _ := filepath.Abs(path)
+	file, ok := r.Files[key]
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Size() == file.Size && info.ModTime().Equal(file.ModTime)
+}
+
+// add records an input as transformed and saves the record
+func (r *watchRecord) add(path, output string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("could not record %s as done: %w", path, err)
+	}
+	key, _ := filepath.Abs(path)
+	r.Files[key] = watchedFile{Size: info.Size(), ModTime: info.ModTime(), Output: output}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not save the watch record: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("could not save the watch record: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("could not save the watch record: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("could not save the watch record: %w", err)
+	}
+	return nil
+}